@@ -1,6 +1,7 @@
 package attestation
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"crypto/ecdsa"
@@ -13,6 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"slices"
@@ -30,6 +33,11 @@ const (
 	SevGuestV2 PredicateType = "https://tinfoil.sh/predicate/sev-snp-guest/v2"
 	TdxGuestV2 PredicateType = "https://tinfoil.sh/predicate/tdx-guest/v2"
 
+	// CC guest v3 types include the TLS key fingerprint and a commitment to the HPKE public key and response signing key,
+	// which are carried in the document. Their measurements have the same type as the v2 formats.
+	SevGuestV3 PredicateType = "https://tinfoil.sh/predicate/sev-snp-guest/v3"
+	TdxGuestV3 PredicateType = "https://tinfoil.sh/predicate/tdx-guest/v3"
+
 	SnpTdxMultiPlatformV1  PredicateType = "https://tinfoil.sh/predicate/snp-tdx-multiplatform/v1"
 	HardwareMeasurementsV1 PredicateType = "https://tinfoil.sh/predicate/hardware-measurements/v1"
 
@@ -45,6 +53,7 @@ var (
 	ErrFewRegisters                = errors.New("fewer registers than expected")
 	ErrMultiPlatformMismatch       = errors.New("multi-platform measurement mismatch")
 	ErrMultiPlatformSevSnpMismatch = errors.New("multi-platform SEV-SNP measurement mismatch")
+	ErrKeyCommitmentMismatch       = errors.New("report data does not commit to the document's keys")
 )
 
 type Measurement struct {
@@ -83,9 +92,10 @@ func Fingerprint(m *Measurement, hw *HardwareMeasurement, targetType PredicateTy
 }
 
 type Verification struct {
-	Measurement    *Measurement `json:"measurement"`
-	TLSPublicKeyFP string       `json:"tls_public_key,omitempty"`
-	HPKEPublicKey  string       `json:"hpke_public_key,omitempty"`
+	Measurement      *Measurement `json:"measurement"`
+	TLSPublicKeyFP   string       `json:"tls_public_key,omitempty"`
+	HPKEPublicKey    string       `json:"hpke_public_key,omitempty"`
+	SigningPublicKey string       `json:"signing_public_key,omitempty"`
 }
 
 func newVerificationV2(measurement *Measurement, keys []byte) *Verification {
@@ -96,6 +106,49 @@ func newVerificationV2(measurement *Measurement, keys []byte) *Verification {
 	}
 }
 
+// KeyCommitment returns the report data commitment of v3 documents to the HPKE public key and response signing key
+func KeyCommitment(hpkePublicKey, signingPublicKey []byte) []byte {
+	h := sha256.New()
+	h.Write(hpkePublicKey)
+	h.Write(signingPublicKey)
+	return h.Sum(nil)
+}
+
+// newVerificationV3 checks that the report data of a verified v3 document commits to the document's
+// HPKE public key and response signing key. The report data is parsed with the v2 layout, whose
+// second half holds the commitment. Both keys must be 32 bytes, since the commitment hashes them
+// without a separator and keys of other lengths could shift bytes from one key to the other.
+func newVerificationV3(reportVerification *Verification, d *Document) (*Verification, error) {
+	commitment, err := hex.DecodeString(reportVerification.HPKEPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	hpkePublicKey, err := hex.DecodeString(d.HPKEPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HPKE public key: %v", err)
+	}
+	if len(hpkePublicKey) != 32 {
+		return nil, fmt.Errorf("invalid HPKE public key: %d bytes, expected 32", len(hpkePublicKey))
+	}
+	signingPublicKey, err := hex.DecodeString(d.SigningPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing public key: %v", err)
+	}
+	if len(signingPublicKey) != 32 {
+		return nil, fmt.Errorf("invalid signing public key: %d bytes, expected 32", len(signingPublicKey))
+	}
+	if !bytes.Equal(commitment, KeyCommitment(hpkePublicKey, signingPublicKey)) {
+		return nil, ErrKeyCommitmentMismatch
+	}
+
+	return &Verification{
+		Measurement:      reportVerification.Measurement,
+		TLSPublicKeyFP:   reportVerification.TLSPublicKeyFP,
+		HPKEPublicKey:    d.HPKEPublicKey,
+		SigningPublicKey: d.SigningPublicKey,
+	}, nil
+}
+
 func (m *Measurement) EqualsDisplay(other *Measurement) (string, error) {
 	// Base case: if both measurements are multi-platform, compare directly
 	if m.Type == SnpTdxMultiPlatformV1 && other.Type == SnpTdxMultiPlatformV1 {
@@ -218,6 +271,10 @@ func (m *Measurement) String() string {
 type Document struct {
 	Format PredicateType `json:"format"`
 	Body   string        `json:"body"`
+
+	// Keys committed to by the report data of v3 formats
+	HPKEPublicKey    string `json:"hpke_public_key,omitempty"`
+	SigningPublicKey string `json:"signing_public_key,omitempty"`
 }
 
 // Bundle represents a complete attestation bundle for single-request verification
@@ -266,6 +323,18 @@ func (d *Document) VerifyWithVCEK(vcekDER []byte) (*Verification, error) {
 		return verifySevAttestationV2WithVCEK(d.Body, vcekDER)
 	case TdxGuestV2:
 		return verifyTdxAttestationV2(d.Body)
+	case SevGuestV3:
+		verification, err := verifySevAttestationV2WithVCEK(d.Body, vcekDER)
+		if err != nil {
+			return nil, err
+		}
+		return newVerificationV3(verification, d)
+	case TdxGuestV3:
+		verification, err := verifyTdxAttestationV2(d.Body)
+		if err != nil {
+			return nil, err
+		}
+		return newVerificationV3(verification, d)
 	default:
 		return nil, fmt.Errorf("unsupported attestation format: %s", d.Format)
 	}
@@ -326,6 +395,42 @@ func Fetch(host string) (*Document, error) {
 	return &doc, nil
 }
 
+// FetchFromConn retrieves the attestation document from a given enclave hostname over an established
+// connection, so that the document is known to come from the endpoint of that connection. The connection
+// is left open for further HTTP/1.1 requests.
+func FetchFromConn(conn net.Conn, host string) (*Document, error) {
+	u := url.URL{Scheme: "https", Host: host, Path: attestationEndpoint}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP GET %s: %s", u.String(), resp.Status)
+	}
+	if resp.Close {
+		return nil, fmt.Errorf("enclave closed the connection after the attestation")
+	}
+
+	var doc Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
 const defaultAttestationBundleURL = "https://atc.tinfoil.sh"
 
 // FetchBundle retrieves a complete attestation bundle from the default endpoint
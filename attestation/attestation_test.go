@@ -1,6 +1,12 @@
 package attestation
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -179,3 +185,62 @@ func TestAttestationFingerprint(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchFromConn(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/.well-known/tinfoil-attestation", r.URL.Path)
+		w.Write([]byte(`{"format":"https://tinfoil.sh/predicate/tdx-guest/v2","body":"report"}`))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	conn, err := tls.Dial("tcp", host, server.Client().Transport.(*http.Transport).TLSClientConfig)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The connection stays usable for further requests
+	for i := 0; i < 2; i++ {
+		doc, err := FetchFromConn(conn, host)
+		require.NoError(t, err)
+		assert.Equal(t, TdxGuestV2, doc.Format)
+		assert.Equal(t, "report", doc.Body)
+	}
+}
+
+func TestVerificationV3KeyCommitment(t *testing.T) {
+	tlsKeyFP := bytes.Repeat([]byte{1}, 32)
+	hpkePublicKey := bytes.Repeat([]byte{2}, 32)
+	signingPublicKey := bytes.Repeat([]byte{3}, 32)
+	measurement := &Measurement{Type: SevGuestV2, Registers: []string{"m"}}
+
+	reportData := append(append([]byte{}, tlsKeyFP...), KeyCommitment(hpkePublicKey, signingPublicKey)...)
+	doc := &Document{
+		Format:           SevGuestV3,
+		HPKEPublicKey:    hex.EncodeToString(hpkePublicKey),
+		SigningPublicKey: hex.EncodeToString(signingPublicKey),
+	}
+
+	verification, err := newVerificationV3(newVerificationV2(measurement, reportData), doc)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(tlsKeyFP), verification.TLSPublicKeyFP)
+	assert.Equal(t, doc.HPKEPublicKey, verification.HPKEPublicKey)
+	assert.Equal(t, doc.SigningPublicKey, verification.SigningPublicKey)
+	assert.Equal(t, measurement, verification.Measurement)
+
+	// A document carrying keys other than the committed ones is rejected
+	doc.SigningPublicKey = hex.EncodeToString(bytes.Repeat([]byte{4}, 32))
+	_, err = newVerificationV3(newVerificationV2(measurement, reportData), doc)
+	assert.ErrorIs(t, err, ErrKeyCommitmentMismatch)
+
+	// Keys that hash to the same commitment when split at another byte are rejected
+	keys := append(append([]byte{}, hpkePublicKey...), signingPublicKey...)
+	doc.HPKEPublicKey = hex.EncodeToString(keys[:33])
+	doc.SigningPublicKey = hex.EncodeToString(keys[33:])
+	_, err = newVerificationV3(newVerificationV2(measurement, reportData), doc)
+	assert.ErrorContains(t, err, "invalid HPKE public key")
+
+	doc.HPKEPublicKey = hex.EncodeToString(hpkePublicKey)
+	doc.SigningPublicKey = hex.EncodeToString(append(signingPublicKey, 0))
+	_, err = newVerificationV3(newVerificationV2(measurement, reportData), doc)
+	assert.ErrorContains(t, err, "invalid signing public key")
+}
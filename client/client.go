@@ -2,13 +2,24 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/x509"
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
+	"net"
 	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/config"
 	"github.com/tinfoilsh/verifier/github"
 	"github.com/tinfoilsh/verifier/sigstore"
 	"github.com/tinfoilsh/verifier/util"
@@ -27,12 +38,16 @@ type GroundTruth struct {
 	EnclaveHost         string                           `json:"enclave_host,omitempty"`
 	TLSPublicKey        string                           `json:"tls_public_key,omitempty"`
 	HPKEPublicKey       string                           `json:"hpke_public_key,omitempty"`
+	SigningPublicKey    string                           `json:"signing_public_key,omitempty"`
+	Tag                 string                           `json:"tag,omitempty"`
 	Digest              string                           `json:"digest"`
 	CodeMeasurement     *attestation.Measurement         `json:"code_measurement"`
 	EnclaveMeasurement  *attestation.Measurement         `json:"enclave_measurement"`
 	HardwareMeasurement *attestation.HardwareMeasurement `json:"hardware_measurement,omitempty"`
 	CodeFingerprint     string                           `json:"code_fingerprint"`
 	EnclaveFingerprint  string                           `json:"enclave_fingerprint"`
+	// Provenance records the transparency log entry and signer of the release's attestation; nil for pinned measurements
+	Provenance *sigstore.Provenance `json:"provenance,omitempty"`
 }
 
 type SecureClient struct {
@@ -42,8 +57,170 @@ type SecureClient struct {
 	codeMeasurement      *attestation.Measurement
 	hardwareMeasurements []*attestation.HardwareMeasurement
 
-	groundTruth    *GroundTruth
-	sigstoreClient *sigstore.Client
+	// Release to verify instead of the latest one
+	releaseTag, releaseDigest string
+
+	// Releases the enclave may run instead of only the latest one
+	allowedReleases *config.Config
+	lastReleases    int
+	// How long ago the release's attestation may have been logged
+	maxReleaseAge time.Duration
+	// Signer identity the release's sigstore bundle must be signed with
+	identityPolicy *sigstore.IdentityPolicy
+	// Where releases and attestations are fetched from instead of the default proxies
+	githubSource *github.Source
+	// Image repository whose OCI referrers attestations are fetched from instead of the GitHub source
+	ociRepository string
+	ociOptions    []remote.Option
+
+	// Encrypt bodies to the attested HPKE key instead of pinning TLS
+	ehbp bool
+	// Verify response signatures by the attested signing key instead of pinning TLS
+	signedResponses bool
+
+	// mu guards enclave, groundTruth, the in-flight verification and the attested connections
+	mu          sync.RWMutex
+	groundTruth *GroundTruth
+	verifying   *verifyCall
+
+	// Backends behind the enclave hostname verified in addition to the ground truth, keyed by TLS key fingerprint
+	backends map[string]*GroundTruth
+	// Connection the ground truth was attested over, used by the first request
+	pendingConn net.Conn
+	pendingAddr string
+	pendingAt   time.Time
+	transport   *http.Transport
+	// bodyTransport carries EHBP and signed response requests when the enclave is dialed or trusted differently
+	bodyTransport *http.Transport
+
+	// rootCAs verify enclave certificates instead of the system roots
+	rootCAs *x509.CertPool
+	// dial opens the connections that TLS connections to the enclave run over instead of a net.Dialer
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// sigstoreMu guards sigstore, which may be shared with other clients
+	sigstoreMu        sync.Mutex
+	sigstore          *sigstoreLoader
+	trustRootCacheDir string
+	trustRoots        []sigstore.TrustRootOptions
+	// Where hardware measurements come from instead of the latest release of the default repo, and how long they are cached
+	hardwareProvider sigstore.HardwareProvider
+	hardwareCacheTTL time.Duration
+
+	// Persisted ground truth restored instead of a full verification
+	store             GroundTruthStore
+	checkLatestDigest bool
+
+	// code shares the code verification with other replicas of the same repo
+	code *codeLoader
+	// releases caches the candidate releases verified against the release policy, and may be shared with other clients
+	releases *releaseCache
+	// candidates are the release tags the ground truth was matched against, guarded by mu
+	candidates []string
+
+	// verifyFunc and verifyTagFunc replace the verification of the enclave and of a candidate release,
+	// which need attestation hardware and signed releases, for enclave stand-ins
+	verifyFunc    func(enclave string) (*GroundTruth, error)
+	verifyTagFunc func(sigstoreClient *sigstore.Client, tag string) (*release, error)
+}
+
+// sigstoreLoader lazily creates a sigstore client that can be shared between secure clients,
+// together with the hardware measurement provider so that its cache is shared too
+type sigstoreLoader struct {
+	mu         sync.Mutex
+	client     *sigstore.Client
+	trustRoots []sigstore.TrustRootOptions
+	// hardware is nil to fetch the latest measurements of the default repo
+	hardware sigstore.HardwareProvider
+}
+
+func (l *sigstoreLoader) get() (*sigstore.Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client == nil {
+		var err error
+		l.client, err = sigstore.NewClientWithTrustRoots(l.trustRoots...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sigstore client: %v", err)
+		}
+	}
+	return l.client, nil
+}
+
+// codeLoader shares a code verification between secure clients of the same repo.
+// Failed verifications are not cached; reset forces the next call to verify again.
+type codeLoader struct {
+	mu      sync.Mutex
+	release *release
+}
+
+func (l *codeLoader) get(verify func() (*release, error)) (*release, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.release == nil {
+		release, err := verify()
+		if err != nil {
+			return nil, err
+		}
+		l.release = release
+	}
+	return l.release, nil
+}
+
+func (l *codeLoader) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.release = nil
+}
+
+// releaseCache shares verified candidate releases between secure clients of the same repo, keyed by tag.
+// Concurrent lookups of a tag share one verification, and failures are not cached.
+type releaseCache struct {
+	mu       sync.Mutex
+	releases map[string]*releaseCall
+}
+
+type releaseCall struct {
+	done    chan struct{}
+	release *release
+	err     error
+}
+
+// get returns the cached release with the tag, or verifies it. A nil cache always verifies.
+func (c *releaseCache) get(tag string, verify func() (*release, error)) (*release, error) {
+	if c == nil {
+		return verify()
+	}
+	c.mu.Lock()
+	if call, ok := c.releases[tag]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.release, call.err
+	}
+	if c.releases == nil {
+		c.releases = make(map[string]*releaseCall)
+	}
+	call := &releaseCall{done: make(chan struct{})}
+	c.releases[tag] = call
+	c.mu.Unlock()
+
+	call.release, call.err = verify()
+	if call.err != nil {
+		c.mu.Lock()
+		delete(c.releases, tag)
+		c.mu.Unlock()
+	}
+	close(call.done)
+	return call.release, call.err
+}
+
+// verifyCall is a verification shared by all callers that arrive while it is running
+type verifyCall struct {
+	done        chan struct{}
+	groundTruth *GroundTruth
+	err         error
+	// waiters counts the callers that joined the verification, guarded by the client's mu
+	waiters int
 }
 
 var (
@@ -67,21 +244,30 @@ func fetchRouters() ([]string, error) {
 }
 
 // NewSecureClient creates a new secure client with a given repo and enclave
-func NewSecureClient(enclave, repo string) *SecureClient {
-	return &SecureClient{
-		enclave: enclave,
-		repo:    repo,
+func NewSecureClient(enclave, repo string, opts ...Option) *SecureClient {
+	s := &SecureClient{
+		enclave:  enclave,
+		repo:     repo,
+		releases: &releaseCache{},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // NewPinnedSecureClient creates a new secure client with a given enclave and fixed measurements
-func NewPinnedSecureClient(enclave string, codeMeasurement *attestation.Measurement, hardwareMeasurements []*attestation.HardwareMeasurement) *SecureClient {
-	return &SecureClient{
+func NewPinnedSecureClient(enclave string, codeMeasurement *attestation.Measurement, hardwareMeasurements []*attestation.HardwareMeasurement, opts ...Option) *SecureClient {
+	s := &SecureClient{
 		enclave:              enclave,
 		repo:                 pinnedNoRepo,
 		codeMeasurement:      codeMeasurement,
 		hardwareMeasurements: hardwareMeasurements,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // NewDefaultSecureClient creates a new secure client with fallback mechanism.
@@ -110,6 +296,8 @@ func NewDefaultClient() (*SecureClient, error) {
 
 // Enclave returns the enclave URL
 func (s *SecureClient) Enclave() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.enclave
 }
 
@@ -120,115 +308,306 @@ func (s *SecureClient) Repo() string {
 
 // GroundTruth returns the last verified enclave state
 func (s *SecureClient) GroundTruth() *GroundTruth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.groundTruth
 }
 
+// Backends returns the ground truths of all verified backends serving the enclave hostname, starting with the client's ground truth
+func (s *SecureClient) Backends() []*GroundTruth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var backends []*GroundTruth
+	if s.groundTruth != nil {
+		backends = append(backends, s.groundTruth)
+	}
+	keys := slices.Sorted(maps.Keys(s.backends))
+	for _, key := range keys {
+		backends = append(backends, s.backends[key])
+	}
+	return backends
+}
+
+// pinsTLS reports whether the enclave's TLS key is pinned, rather than bodies being bound to an attested key
+func (s *SecureClient) pinsTLS() bool {
+	return !s.ehbp && !s.signedResponses
+}
+
+func (s *SecureClient) verifiedBackend(certFP string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.groundTruth != nil && s.groundTruth.TLSPublicKey == certFP {
+		return true
+	}
+	_, ok := s.backends[certFP]
+	return ok
+}
+
+func (s *SecureClient) addBackend(groundTruth *GroundTruth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backends == nil {
+		s.backends = map[string]*GroundTruth{}
+	}
+	s.backends[groundTruth.TLSPublicKey] = groundTruth
+}
+
+// keepAttestedConn keeps the connection the enclave was attested over for the HTTP transport's first request to addr.
+// Clients used only through DialContext, TLSConfig or gRPC never pick the connection up, so it is closed instead;
+// this also applies to a Verify call made before the HTTP transport is first used.
+func (s *SecureClient) keepAttestedConn(conn net.Conn, addr string) {
+	s.mu.RLock()
+	usesTransport := s.transport != nil
+	s.mu.RUnlock()
+	if !usesTransport {
+		conn.Close()
+		return
+	}
+	s.setPendingConn(conn, addr)
+}
+
+// pendingConnMaxAge bounds how long the connection the enclave was attested over is kept for the first request,
+// since the server may have closed it while it sat idle
+const pendingConnMaxAge = 10 * time.Second
+
+// setPendingConn keeps the connection the enclave was attested over for the first request to addr
+func (s *SecureClient) setPendingConn(conn net.Conn, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropPendingConn()
+	s.pendingConn, s.pendingAddr, s.pendingAt = conn, addr, time.Now()
+}
+
+// takePendingConn returns the connection kept for the first request to addr, unless it has been kept too long
+func (s *SecureClient) takePendingConn(addr string) net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pendingConn == nil || s.pendingAddr != addr {
+		return nil
+	}
+	if time.Since(s.pendingAt) > pendingConnMaxAge {
+		s.dropPendingConn()
+		return nil
+	}
+	conn := s.pendingConn
+	s.pendingConn = nil
+	return conn
+}
+
+// dropPendingConn closes the connection kept for the first request. s.mu must be held.
+func (s *SecureClient) dropPendingConn() {
+	if s.pendingConn != nil {
+		s.pendingConn.Close()
+		s.pendingConn = nil
+	}
+}
+
 // GroundTruthJSON returns the ground truth as a JSON string
 func (s *SecureClient) GroundTruthJSON() (string, error) {
-	encoded, err := json.Marshal(s.groundTruth)
+	encoded, err := json.Marshal(s.GroundTruth())
 	if err != nil {
 		return "", err
 	}
 	return string(encoded), nil
 }
 
-func (s *SecureClient) getSigstoreClient() (*sigstore.Client, error) {
-	if s.sigstoreClient == nil {
-		var err error
-		s.sigstoreClient, err = sigstore.NewClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create sigstore client: %v", err)
-		}
+func (s *SecureClient) sharedSigstore() *sigstoreLoader {
+	s.sigstoreMu.Lock()
+	defer s.sigstoreMu.Unlock()
+	if s.sigstore == nil {
+		s.sigstore = &sigstoreLoader{trustRoots: s.trustRootOptions(), hardware: s.hardwareOptions()}
 	}
-	return s.sigstoreClient, nil
+	return s.sigstore
 }
 
-// Verify fetches the latest verification information from GitHub and Sigstore and stores the ground truth results in the client
-func (s *SecureClient) Verify() (*GroundTruth, error) {
-	var codeMeasurement = s.codeMeasurement
-	var digest = pinnedNoDigest
-	if s.codeMeasurement == nil {
-		var err error
-		digest, err = github.FetchLatestDigest(s.repo)
-		if err != nil {
-			return nil, fmt.Errorf("fetchDigest: failed to fetch latest release: %v", err)
+// hardwareOptions returns the configured hardware measurement provider, cached if a cache TTL is set
+func (s *SecureClient) hardwareOptions() sigstore.HardwareProvider {
+	provider := s.hardwareProvider
+	if s.hardwareCacheTTL > 0 {
+		if provider == nil {
+			provider = sigstore.HardwareRepo{Repo: sigstore.DefaultHardwareRepo}
 		}
+		provider = sigstore.NewCachedHardware(provider, s.hardwareCacheTTL)
+	}
+	return provider
+}
 
-		sigstoreClient, err := s.getSigstoreClient()
-		if err != nil {
-			return nil, fmt.Errorf("verifyCode: failed to create sigstore client: %v", err)
-		}
+// trustRootOptions returns the Sigstore trusted roots to verify against, by default the public good instance.
+// The embedded root is the fallback for the public good instance only.
+func (s *SecureClient) trustRootOptions() []sigstore.TrustRootOptions {
+	trustRoots := s.trustRoots
+	if len(trustRoots) == 0 {
+		trustRoots = []sigstore.TrustRootOptions{{}}
+	}
 
-		sigstoreBundle, err := github.FetchAttestationBundle(s.repo, digest)
-		if err != nil {
-			return nil, fmt.Errorf("verifyCode: failed to fetch attestation bundle: %v", err)
+	options := make([]sigstore.TrustRootOptions, len(trustRoots))
+	for i, opts := range trustRoots {
+		if opts.CacheDir == "" {
+			opts.CacheDir = s.trustRootCacheDir
 		}
-
-		codeMeasurement, err = sigstoreClient.VerifyAttestation(sigstoreBundle, s.repo, digest)
-		if err != nil {
-			return nil, fmt.Errorf("verifyCode: failed to verify attested measurements: %v", err)
+		if opts.Mirror == "" && len(opts.Embedded) == 0 {
+			opts.Embedded = embeddedTrustedRoot
 		}
+		options[i] = opts
+	}
+	return options
+}
+
+// TrustRootStatus describes where the Sigstore trusted root was loaded from and how old it is.
+// With several trusted roots it describes the first; TrustRootStatuses describes all of them.
+// It returns nil until the trusted root has been loaded by a verification.
+func (s *SecureClient) TrustRootStatus() *sigstore.TrustRootStatus {
+	loader := s.sharedSigstore()
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if loader.client == nil {
+		return nil
+	}
+	return loader.client.TrustRootStatus()
+}
+
+// TrustRootStatuses describes each of the client's Sigstore trusted roots, in the order they were given.
+// It returns nil until the trusted roots have been loaded by a verification.
+func (s *SecureClient) TrustRootStatuses() []*sigstore.TrustRootStatus {
+	loader := s.sharedSigstore()
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if loader.client == nil {
+		return nil
 	}
+	return loader.client.TrustRootStatuses()
+}
 
-	enclaveAttestation, err := attestation.Fetch(s.enclave)
-	if err != nil {
-		return nil, fmt.Errorf("verifyEnclave: failed to fetch enclave measurements: %v", err)
+// getSigstoreClient returns the shared sigstore client, bound to the client's signer identity policy if it has one
+func (s *SecureClient) getSigstoreClient() (*sigstore.Client, error) {
+	client, err := s.sharedSigstore().get()
+	identity := s.identity()
+	if err != nil || identity == nil {
+		return client, err
 	}
-	enclaveVerification, err := enclaveAttestation.Verify()
-	if err != nil {
-		return nil, fmt.Errorf("verifyEnclave: failed to verify enclave measurements: %v", err)
+	return client.WithIdentityPolicy(*identity), nil
+}
+
+// identity returns the signer identity policy, on the GitHub Enterprise Server of the GitHub source unless the policy
+// names another instance, or nil for the default policy
+func (s *SecureClient) identity() *sigstore.IdentityPolicy {
+	if s.githubSource == nil || s.githubSource.ServerURL == "" {
+		return s.identityPolicy
+	}
+	var policy sigstore.IdentityPolicy
+	if s.identityPolicy != nil {
+		policy = *s.identityPolicy
+	}
+	if policy.ServerURL == "" && policy.Issuer == "" {
+		enterprise := sigstore.EnterpriseIdentityPolicy(s.githubSource.ServerURL)
+		policy.ServerURL, policy.Issuer = enterprise.ServerURL, enterprise.Issuer
 	}
+	return &policy
+}
 
-	// Fetch hardware platform measurements if required
-	var matchedHwMeasurement *attestation.HardwareMeasurement
-	if enclaveAttestation.Format == attestation.TdxGuestV2 {
-		var hwMeasurements = s.hardwareMeasurements
-		if len(s.hardwareMeasurements) == 0 {
-			sigstoreClient, err := s.getSigstoreClient()
-			if err != nil {
-				return nil, fmt.Errorf("verifyHardware: failed to create sigstore client: %v", err)
-			}
-			hwMeasurements, err = sigstoreClient.LatestHardwareMeasurements()
-			if err != nil {
-				return nil, fmt.Errorf("verifyHardware: failed to fetch TDX platform measurements: %v", err)
-			}
-		}
+// Verify fetches the latest verification information from GitHub and Sigstore and stores the ground truth results in the client.
+// Concurrent calls share a single in-flight verification. Verify always runs a full verification;
+// a ground truth from the store is only restored for requests made before the client was verified.
+func (s *SecureClient) Verify() (*GroundTruth, error) {
+	return s.sharedVerify(false)
+}
 
-		matchedHwMeasurement, err = attestation.VerifyHardware(hwMeasurements, enclaveVerification.Measurement)
-		if err != nil {
-			return nil, fmt.Errorf("verifyHardware: failed to verify hardware measurements: %v", err)
-		}
+// sharedVerifyContext is sharedVerify that gives up once ctx is done. The verification keeps running
+// for the callers sharing it, so a later call can still use its result.
+func (s *SecureClient) sharedVerifyContext(ctx context.Context, cached bool) (*GroundTruth, error) {
+	return withContext(ctx, func() (*GroundTruth, error) {
+		return s.sharedVerify(cached)
+	})
+}
+
+// withContext returns the result of f, or ctx's error once ctx is done. f keeps running after the caller gave up,
+// so it must be safe to complete in the background.
+func withContext[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
 	}
+}
 
-	if err := enclaveValidPubKey(s.enclave, enclaveVerification); err != nil {
-		return nil, fmt.Errorf("validateTLS: %v", err)
+// sharedVerify joins the in-flight verification or starts a new one.
+// If cached is set, an existing ground truth is returned without verifying again.
+func (s *SecureClient) sharedVerify(cached bool) (*GroundTruth, error) {
+	s.mu.Lock()
+	if cached && s.groundTruth != nil {
+		groundTruth := s.groundTruth
+		s.mu.Unlock()
+		return groundTruth, nil
+	}
+	if call := s.verifying; call != nil {
+		call.waiters++
+		s.mu.Unlock()
+		<-call.done
+		return call.groundTruth, call.err
+	}
+	call := &verifyCall{done: make(chan struct{})}
+	s.verifying = call
+	s.mu.Unlock()
+
+	call.groundTruth, call.err = s.runVerify(cached)
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.groundTruth = call.groundTruth
+		// Backends verified against the previous ground truth must be verified again
+		s.backends = nil
+		if s.transport != nil {
+			s.transport.CloseIdleConnections()
+		}
+	} else {
+		// The connection was attested by an enclave that failed verification
+		s.dropPendingConn()
 	}
+	s.verifying = nil
+	s.mu.Unlock()
+	close(call.done)
 
-	if err = codeMeasurement.Equals(enclaveVerification.Measurement); err != nil {
-		return nil, fmt.Errorf("measurements: %v", err)
+	return call.groundTruth, call.err
+}
+
+// runVerify restores the stored ground truth if allowed and still valid, and otherwise runs a full verification
+func (s *SecureClient) runVerify(restore bool) (*GroundTruth, error) {
+	if restore && s.store != nil {
+		if groundTruth, err := s.restoreGroundTruth(); err == nil {
+			s.mu.Lock()
+			s.candidates = nil
+			s.mu.Unlock()
+			return groundTruth, nil
+		}
 	}
 
-	codeFingerprint, err := attestation.Fingerprint(codeMeasurement, matchedHwMeasurement, enclaveVerification.Measurement.Type)
-	if err != nil {
-		return nil, fmt.Errorf("measurements: failed to compute code fingerprint: %v", err)
+	verify := s.verify
+	if s.verifyFunc != nil {
+		verify = func() (*GroundTruth, error) { return s.verifyFunc(s.Enclave()) }
 	}
-	enclaveFingerprint, err := attestation.Fingerprint(enclaveVerification.Measurement, matchedHwMeasurement, enclaveVerification.Measurement.Type)
+	groundTruth, err := verify()
 	if err != nil {
-		return nil, fmt.Errorf("measurements: failed to compute enclave fingerprint: %v", err)
+		return nil, err
 	}
-
-	s.groundTruth = &GroundTruth{
-		EnclaveHost:         s.enclave,
-		TLSPublicKey:        enclaveVerification.TLSPublicKeyFP,
-		HPKEPublicKey:       enclaveVerification.HPKEPublicKey,
-		Digest:              digest,
-		HardwareMeasurement: matchedHwMeasurement,
-		CodeMeasurement:     codeMeasurement,
-		EnclaveMeasurement:  enclaveVerification.Measurement,
-		CodeFingerprint:     codeFingerprint,
-		EnclaveFingerprint:  enclaveFingerprint,
+	if repo, ok := s.storeRepo(); s.store != nil && ok {
+		// Persisting is best effort; the next process will verify again
+		_ = s.store.Save(s.Enclave(), repo, groundTruth)
 	}
-	return s.groundTruth, nil
+	return groundTruth, nil
 }
 
 // VerifyFromBundle verifies using a pre-fetched attestation bundle (single-request verification)
@@ -238,10 +617,15 @@ func (s *SecureClient) VerifyFromBundle(bundle *attestation.Bundle) (*GroundTrut
 		return nil, fmt.Errorf("verifyCode: failed to create sigstore client: %v", err)
 	}
 
-	codeMeasurement, err := sigstoreClient.VerifyAttestation(bundle.SigstoreBundle, s.repo, bundle.Digest)
+	// The bundle does not say which release it is for, so only a pinned tag can be checked
+	verified, err := verifyAttestations(sigstoreClient, [][]byte{bundle.SigstoreBundle}, s.repo, s.releaseTag, bundle.Digest)
 	if err != nil {
 		return nil, fmt.Errorf("verifyCode: failed to verify attested measurements: %v", err)
 	}
+	codeMeasurement := verified.Measurement
+	if err := s.checkReleaseAge(&release{tag: s.releaseTag, digest: bundle.Digest, provenance: verified.Provenance}); err != nil {
+		return nil, fmt.Errorf("verifyCode: %v", err)
+	}
 
 	// Decode VCEK from base64 DER format
 	vcekDER, err := base64.StdEncoding.DecodeString(bundle.VCEK)
@@ -281,8 +665,7 @@ func (s *SecureClient) VerifyFromBundle(bundle *attestation.Bundle) (*GroundTrut
 		return nil, fmt.Errorf("verifyCertificate: %v", err)
 	}
 
-	s.enclave = bundle.Domain
-	s.groundTruth = &GroundTruth{
+	groundTruth := &GroundTruth{
 		EnclaveHost:        bundle.Domain,
 		TLSPublicKey:       enclaveVerification.TLSPublicKeyFP,
 		HPKEPublicKey:      enclaveVerification.HPKEPublicKey,
@@ -291,46 +674,76 @@ func (s *SecureClient) VerifyFromBundle(bundle *attestation.Bundle) (*GroundTrut
 		EnclaveMeasurement: enclaveVerification.Measurement,
 		CodeFingerprint:    codeFingerprint,
 		EnclaveFingerprint: enclaveFingerprint,
+		Provenance:         verified.Provenance,
 	}
-	return s.groundTruth, nil
+
+	s.mu.Lock()
+	s.enclave = bundle.Domain
+	s.groundTruth = groundTruth
+	s.mu.Unlock()
+	return groundTruth, nil
 }
 
-// HTTPClient returns an HTTP client that only accepts TLS connections to the verified enclave
+// HTTPClient returns an HTTP client that only accepts TLS connections to the verified enclave,
+// that encrypts bodies to the verified enclave's HPKE key when EHBP is enabled,
+// or that verifies response signatures when response signatures are enabled.
+// Each new TLS connection is attested by the backend it reaches before any request is sent over it.
 func (s *SecureClient) HTTPClient() (*http.Client, error) {
-	if s.groundTruth == nil {
-		_, err := s.Verify()
-		if err != nil {
-			return nil, fmt.Errorf("failed to verify enclave: %v", err)
-		}
+	if s.pinsTLS() {
+		s.initTransport()
+	}
+	groundTruth, err := s.sharedVerify(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify enclave: %v", err)
 	}
 
+	if s.ehbp {
+		return &http.Client{
+			Transport: &EHBPTransport{PublicKey: groundTruth.HPKEPublicKey, Base: s.baseTransport()},
+		}, nil
+	}
+	if s.signedResponses {
+		return &http.Client{
+			Transport: &SignedResponseTransport{SigningPublicKey: groundTruth.SigningPublicKey, Base: s.baseTransport()},
+		}, nil
+	}
 	return &http.Client{
-		Transport: &TLSBoundRoundTripper{s.groundTruth.TLSPublicKey},
+		Transport: s.tlsTransport(),
 	}, nil
 }
 
-func (s *SecureClient) makeRequest(req *http.Request) (*Response, error) {
+// Do sends an HTTP request to the verified enclave and returns the unbuffered response.
+// The response body is streamed as it arrives and must be closed by the caller.
+func (s *SecureClient) Do(req *http.Request) (*http.Response, error) {
 	httpClient, err := s.HTTPClient()
 	if err != nil {
-		return nil, err
+		return nil, &notSentError{err}
 	}
 
 	// If URL doesn't start with anything, assume it's a relative path and set the base URL
 	if req.URL.Host == "" {
 		req.URL.Scheme = "https"
-		req.URL.Host = s.enclave
+		req.URL.Host = s.Enclave()
 	}
 
-	resp, err := httpClient.Do(req)
+	return httpClient.Do(req)
+}
+
+func (s *SecureClient) makeRequest(req *http.Request) (*Response, error) {
+	resp, err := s.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	return toResponse(resp)
 }
 
-// Post makes an HTTP POST request
-func (s *SecureClient) Post(url string, headers map[string]string, body []byte) (*Response, error) {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+func (s *SecureClient) request(method, url string, headers map[string]string, body []byte) (*Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -340,15 +753,42 @@ func (s *SecureClient) Post(url string, headers map[string]string, body []byte)
 	return s.makeRequest(req)
 }
 
+// Post makes an HTTP POST request
+func (s *SecureClient) Post(url string, headers map[string]string, body []byte) (*Response, error) {
+	return s.request(http.MethodPost, url, headers, body)
+}
+
 // Get makes an HTTP GET request
 func (s *SecureClient) Get(url string, headers map[string]string) (*Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	return s.request(http.MethodGet, url, headers, nil)
+}
+
+// Put makes an HTTP PUT request
+func (s *SecureClient) Put(url string, headers map[string]string, body []byte) (*Response, error) {
+	return s.request(http.MethodPut, url, headers, body)
+}
+
+// Patch makes an HTTP PATCH request
+func (s *SecureClient) Patch(url string, headers map[string]string, body []byte) (*Response, error) {
+	return s.request(http.MethodPatch, url, headers, body)
+}
+
+// Delete makes an HTTP DELETE request
+func (s *SecureClient) Delete(url string, headers map[string]string) (*Response, error) {
+	return s.request(http.MethodDelete, url, headers, nil)
+}
+
+// Head makes an HTTP HEAD request
+func (s *SecureClient) Head(url string, headers map[string]string) (*Response, error) {
+	return s.request(http.MethodHead, url, headers, nil)
+}
+
+// Send makes the HTTP request described by r and buffers the response
+func (s *SecureClient) Send(ctx context.Context, r *Request) (*Response, error) {
+	req, err := r.HTTPRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
 	return s.makeRequest(req)
 }
 
@@ -360,9 +800,9 @@ func VerifyJSON(enclave, repo string, sigstoreTrustedRootJSON []byte) (string, e
 	}
 
 	client := &SecureClient{
-		enclave:        enclave,
-		repo:           repo,
-		sigstoreClient: sigstoreClient,
+		enclave:  enclave,
+		repo:     repo,
+		sigstore: &sigstoreLoader{client: sigstoreClient},
 	}
 	_, err = client.Verify()
 	if err != nil {
@@ -371,22 +811,12 @@ func VerifyJSON(enclave, repo string, sigstoreTrustedRootJSON []byte) (string, e
 	return client.GroundTruthJSON()
 }
 
+// getSigstoreClient uses the given trusted root, falling back to the TUF cache, the TUF repo and finally the embedded root
 func getSigstoreClient(sigstoreTrustedRootJSON []byte) (*sigstore.Client, error) {
-	var trustedRootJSON []byte
-	var err error
-
 	if len(sigstoreTrustedRootJSON) > 0 {
-		trustedRootJSON = sigstoreTrustedRootJSON
-	} else if len(embeddedTrustedRoot) > 0 {
-		trustedRootJSON = embeddedTrustedRoot
-	} else {
-		trustedRootJSON, err = sigstore.FetchTrustRoot()
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch trusted root: %v", err)
-		}
+		return sigstore.NewClientFromJSON(sigstoreTrustedRootJSON)
 	}
-
-	return sigstore.NewClientFromJSON(trustedRootJSON)
+	return sigstore.NewClientWithOptions(sigstore.TrustRootOptions{Embedded: embeddedTrustedRoot})
 }
 
 func verifyBundle(bundle *attestation.Bundle, repo string, sigstoreTrustedRootJSON []byte) (string, error) {
@@ -396,9 +826,9 @@ func verifyBundle(bundle *attestation.Bundle, repo string, sigstoreTrustedRootJS
 	}
 
 	client := &SecureClient{
-		enclave:        bundle.Domain,
-		repo:           repo,
-		sigstoreClient: sigstoreClient,
+		enclave:  bundle.Domain,
+		repo:     repo,
+		sigstore: &sigstoreLoader{client: sigstoreClient},
 	}
 	_, err = client.VerifyFromBundle(bundle)
 	if err != nil {
@@ -2,11 +2,23 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tinfoilsh/verifier/attestation"
+	gh "github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/internal/testutil"
+	"github.com/tinfoilsh/verifier/sigstore"
 )
 
 func TestVerify(t *testing.T) {
@@ -28,6 +40,15 @@ func TestVerify(t *testing.T) {
 	}
 }
 
+func TestVerifyLastReleases(t *testing.T) {
+	client := NewSecureClient("inference.tinfoil.sh", "tinfoilsh/confidential-model-router", WithLastReleases(3))
+	groundTruth, err := client.Verify()
+	assert.NoError(t, err)
+	if groundTruth != nil {
+		assert.NotEmpty(t, groundTruth.Tag)
+	}
+}
+
 func TestClientGroundTruthJSON(t *testing.T) {
 	codeMeasurement := &attestation.Measurement{
 		Type:      attestation.SnpTdxMultiPlatformV1,
@@ -156,3 +177,232 @@ func TestFetchAndVerifyFromURLJSON(t *testing.T) {
 	assert.NotEmpty(t, groundTruth.HPKEPublicKey)
 	assert.NotEmpty(t, groundTruth.Digest)
 }
+
+func TestSecureClientConcurrentRequests(t *testing.T) {
+	// The first verification is held until every request has joined it
+	release := make(chan struct{})
+	var verifications atomic.Int32
+	var pinned *GroundTruth
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), withVerify(func(string) (*GroundTruth, error) {
+		if verifications.Add(1) == 1 {
+			<-release
+		}
+		return pinned, nil
+	}))
+	pinned = client.groundTruth
+	client.groundTruth = nil
+
+	post := func(wg *sync.WaitGroup) {
+		defer wg.Done()
+		resp, err := client.Post("/v1/chat/completions", nil, []byte("hi"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "ok", string(resp.Body))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go post(&wg)
+	}
+	waitForVerifyWaiters(t, client, 49)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), verifications.Load())
+
+	// Swap the ground truth while requests are in flight
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go post(&wg)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			_, err := client.Verify()
+			assert.NoError(t, err)
+			assert.NotNil(t, client.GroundTruth())
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, int32(6), verifications.Load())
+	assert.Equal(t, pinned, client.GroundTruth())
+}
+
+func TestSecureClientSharedVerifyFailure(t *testing.T) {
+	errVerify := errors.New("attestation failed")
+	release := make(chan struct{})
+	var verifications atomic.Int32
+	client := NewSecureClient("enclave.example.com", "tinfoilsh/test", withVerify(func(string) (*GroundTruth, error) {
+		verifications.Add(1)
+		<-release
+		return nil, errVerify
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Verify()
+			assert.ErrorIs(t, err, errVerify)
+		}()
+	}
+	waitForVerifyWaiters(t, client, 9)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), verifications.Load())
+	assert.Nil(t, client.GroundTruth())
+
+	// Failed verifications are not cached
+	_, err := client.HTTPClient()
+	assert.ErrorContains(t, err, errVerify.Error())
+	assert.Equal(t, int32(2), verifications.Load())
+}
+
+// waitForVerifyWaiters waits until n callers have joined the client's in-flight verification
+func waitForVerifyWaiters(t *testing.T, client *SecureClient, n int) {
+	require.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.verifying != nil && client.verifying.waiters == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestSecureClientPinnedDigest(t *testing.T) {
+	client := NewSecureClient("enclave.example.com", "org/repo", WithDigest("abcdef"))
+	tag, digest, err := client.fetchRelease()
+	assert.NoError(t, err)
+	assert.Empty(t, tag)
+	assert.Equal(t, "abcdef", digest)
+
+	// A pinned tag is kept, so the digest's attestation must have been built from it
+	client = NewSecureClient("enclave.example.com", "org/repo", WithDigest("abcdef"), WithReleaseTag("v1.0.0"))
+	tag, digest, err = client.fetchRelease()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", tag)
+	assert.Equal(t, "abcdef", digest)
+}
+
+func TestSecureClientPinnedDigestAndTag(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"attestations": []map[string]any{{"bundle": map[string]any{}}}})
+	}))
+	defer github.Close()
+
+	sigstoreClient, err := sigstore.NewClientFromJSON(embeddedTrustedRoot)
+	require.NoError(t, err)
+	client := NewSecureClient("enclave.example.com", "org/repo", WithDigest("abcdef"), WithReleaseTag("v1.0.0"),
+		WithGitHubSource(&gh.Source{APIURL: github.URL}))
+	client.sigstore = &sigstoreLoader{client: sigstoreClient}
+
+	// The pinned digest's attestations are verified without asking the proxy for the tag's digest
+	_, err = client.verifyCode()
+	assert.ErrorContains(t, err, "verifyCode: failed to verify attested measurements")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/repos/org/repo/attestations/sha256:abcdef"}, paths)
+}
+
+func TestSecureClientMaxReleaseAge(t *testing.T) {
+	client := NewSecureClient("enclave.example.com", "org/repo", WithLastReleases(2), WithMaxReleaseAge(24*time.Hour))
+	recent := &release{tag: "v1.1.0", provenance: &sigstore.Provenance{IntegratedTime: time.Now().Add(-time.Hour)}}
+	old := &release{tag: "v1.0.0", provenance: &sigstore.Provenance{IntegratedTime: time.Now().Add(-48 * time.Hour)}}
+
+	assert.NoError(t, client.checkReleaseAge(recent))
+	assert.ErrorContains(t, client.checkReleaseAge(old), "release v1.0.0 was attested")
+	assert.ErrorContains(t, client.checkReleaseAge(&release{tag: "v1.0.0"}), "no transparency log or timestamp time")
+
+	// A timestamp authority's time counts when the log entry is older
+	old.provenance.SignedTimestamps = []time.Time{time.Now().Add(-time.Hour)}
+	assert.NoError(t, client.checkReleaseAge(old))
+	old.provenance.SignedTimestamps = nil
+
+	// A candidate release the proxy still lists is rejected once it is too old
+	sigstoreClient, err := sigstore.NewClientFromJSON(embeddedTrustedRoot)
+	require.NoError(t, err)
+	measurement := &attestation.Measurement{Type: attestation.SevGuestV2, Registers: []string{"v1.0.0"}}
+	client = NewSecureClient("enclave.example.com", "org/repo", WithLastReleases(2), WithMaxReleaseAge(24*time.Hour),
+		withVerifyTag(func(_ *sigstore.Client, tag string) (*release, error) {
+			return &release{tag: old.tag, measurement: measurement, provenance: old.provenance}, nil
+		}))
+	client.sigstore = &sigstoreLoader{client: sigstoreClient}
+	_, err = client.matchRelease([]string{"v1.0.0"}, measurement)
+	assert.ErrorContains(t, err, "more than 24h0m0s ago")
+
+	// Pinned measurements have no release to check
+	pinned := NewPinnedSecureClient("enclave.example.com", measurement, nil, WithMaxReleaseAge(time.Hour))
+	assert.NoError(t, pinned.checkReleaseAge(old))
+}
+
+func TestSecureClientEnterpriseIdentity(t *testing.T) {
+	src := gh.NewEnterpriseSource("https://github.example.com", "")
+
+	// Releases on an enterprise server are signed by its workflows
+	client := NewSecureClient("enclave.example.com", "org/repo", WithGitHubSource(src))
+	assert.Equal(t, sigstore.EnterpriseIdentityPolicy("https://github.example.com"), *client.identity())
+
+	// The rest of the identity policy is kept
+	client = NewSecureClient("enclave.example.com", "org/repo", WithGitHubSource(src),
+		WithIdentityPolicy(sigstore.IdentityPolicy{Workflow: ".github/workflows/release.yml"}))
+	assert.Equal(t, ".github/workflows/release.yml", client.identity().Workflow)
+	assert.Equal(t, "https://github.example.com/_services/token", client.identity().Issuer)
+
+	// Sources on github.com keep the default policy
+	client = NewSecureClient("enclave.example.com", "org/repo", WithGitHubSource(gh.NewGitHubSource("")))
+	assert.Nil(t, client.identity())
+}
+
+func TestSecureClientOCISource(t *testing.T) {
+	repository, digest, bundle := testutil.NewRegistry(t, true)
+	sigstoreClient, err := sigstore.NewClientFromJSON(embeddedTrustedRoot)
+	require.NoError(t, err)
+
+	client := NewSecureClient("enclave.example.com", "org/repo", WithOCISource(repository), WithDigest(digest))
+	client.sharedSigstore().client = sigstoreClient
+	bundles, err := client.fetchAttestationBundles(digest)
+	require.NoError(t, err)
+	require.Len(t, bundles, 1)
+	assert.JSONEq(t, string(bundle), string(bundles[0]))
+
+	// The unsigned bundle is fetched from the registry but fails verification
+	_, err = client.verifyCode()
+	assert.ErrorContains(t, err, "failed to verify attested measurements")
+}
+
+func TestSecureClientHardwareProvider(t *testing.T) {
+	measurements := []*attestation.HardwareMeasurement{{ID: "hw1@abcd", MRTD: "mrtd", RTMR0: "rtmr0"}}
+	data, err := json.Marshal(measurements)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "hardware.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+
+	sigstoreClient, err := sigstore.NewClientFromJSON(embeddedTrustedRoot)
+	assert.NoError(t, err)
+	pool := NewRouterPool([]string{"a.example.com", "b.example.com"}, "org/repo",
+		WithHardwareProvider(sigstore.HardwareFile(path)),
+		WithHardwareCache(time.Hour),
+	)
+	first, second := pool.routers[0].client, pool.routers[1].client
+	first.sigstore.client = sigstoreClient
+	assert.Same(t, first.sigstore, second.sigstore)
+
+	hwMeasurements, err := first.fetchHardwareMeasurements()
+	assert.NoError(t, err)
+	assert.Equal(t, measurements, hwMeasurements)
+
+	// The second router is served from the shared cache after the file is gone
+	assert.NoError(t, os.Remove(path))
+	hwMeasurements, err = second.fetchHardwareMeasurements()
+	assert.NoError(t, err)
+	assert.Equal(t, measurements, hwMeasurements)
+}
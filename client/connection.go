@@ -0,0 +1,268 @@
+//go:build !wasm
+// +build !wasm
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// attestationTimeout bounds fetching an attestation over a connection when the caller sets no earlier deadline
+const attestationTimeout = 30 * time.Second
+
+// enclaveAddr returns the enclave's address with the default HTTPS port if none is specified
+func enclaveAddr(enclave string) string {
+	if _, _, err := net.SplitHostPort(enclave); err != nil {
+		return net.JoinHostPort(enclave, "443")
+	}
+	return enclave
+}
+
+// dialEnclave opens a TLS connection to the enclave that can carry the attestation request and HTTP/1.1 requests
+func (s *SecureClient) dialEnclave(ctx context.Context, addr string) (*tls.Conn, error) {
+	return s.dialEnclaveProtos(ctx, addr, "http/1.1")
+}
+
+// dialEnclaveProtos opens a TLS connection to the enclave offering the given application protocols
+func (s *SecureClient) dialEnclaveProtos(ctx context.Context, addr string, nextProtos ...string) (*tls.Conn, error) {
+	config := s.tlsConfig(hostname(addr))
+	config.NextProtos = nextProtos
+	return s.dialTLS(ctx, "tcp", addr, config)
+}
+
+// attestConnection fetches and verifies the enclave's attestation over conn and checks that it covers the connection's TLS key.
+// The exchange is abandoned when ctx is done or after attestationTimeout.
+func attestConnection(ctx context.Context, conn *tls.Conn, enclave string) (*attestation.Document, *attestation.Verification, error) {
+	deadline := time.Now().Add(attestationTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	enclaveAttestation, err := attestation.FetchFromConn(conn, enclave)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("verifyEnclave: failed to fetch enclave measurements: %v", err)
+	}
+	enclaveVerification, err := enclaveAttestation.Verify()
+	if err != nil {
+		return nil, nil, fmt.Errorf("verifyEnclave: failed to verify enclave measurements: %v", err)
+	}
+
+	certFP, err := attestation.ConnectionCertFP(conn.ConnectionState())
+	if err != nil {
+		return nil, nil, fmt.Errorf("validateTLS: failed to get certificate fingerprint: %v", err)
+	}
+	if err := enclaveValidPubKey(certFP, enclaveVerification); err != nil {
+		return nil, nil, fmt.Errorf("validateTLS: %v", err)
+	}
+	return enclaveAttestation, enclaveVerification, nil
+}
+
+// attestEnclave fetches the enclave's attestation over a new TLS connection and checks that it covers the connection's key.
+// The connection is returned so that the first request uses the same backend as the attestation.
+func (s *SecureClient) attestEnclave(enclave string) (net.Conn, *attestation.Document, *attestation.Verification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), attestationTimeout)
+	defer cancel()
+	conn, err := s.dialEnclave(ctx, enclaveAddr(enclave))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("validateTLS: failed to connect to enclave: %v", err)
+	}
+	enclaveAttestation, enclaveVerification, err := attestConnection(ctx, conn, enclave)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	return conn, enclaveAttestation, enclaveVerification, nil
+}
+
+// dialAttested dials a connection for the client's transport. The connection left over from verification is used first.
+// A connection presenting a TLS key that has not been verified yet is attested before it is used, so that a new
+// backend behind the same hostname is verified instead of rejected. Connections to verified backends may use HTTP/2,
+// but the attestation is fetched with HTTP/1.1, so a new backend is dialed again without offering HTTP/2.
+func (s *SecureClient) dialAttested(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := s.attestedConn(ctx, addr)
+	if err != nil {
+		// Nothing has been sent over the connection, so a router pool or replica set may retry elsewhere
+		return nil, &notSentError{err}
+	}
+	return conn, nil
+}
+
+func (s *SecureClient) attestedConn(ctx context.Context, addr string) (net.Conn, error) {
+	groundTruth, err := s.sharedVerifyContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	if conn := s.takePendingConn(addr); conn != nil {
+		return conn, nil
+	}
+
+	conn, err := s.dialEnclaveProtos(ctx, addr, "h2", "http/1.1")
+	if err != nil {
+		return nil, err
+	}
+	certFP, err := attestation.ConnectionCertFP(conn.ConnectionState())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if s.verifiedBackend(certFP) {
+		return conn, nil
+	}
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		conn.Close()
+		if conn, err = s.dialEnclave(ctx, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.verifyBackend(ctx, conn, groundTruth); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: failed to verify backend: %v", ErrCertMismatch, err)
+	}
+	return conn, nil
+}
+
+// verifyBackend verifies the backend behind conn against the client's ground truth and adds it to the verified backends
+func (s *SecureClient) verifyBackend(ctx context.Context, conn *tls.Conn, groundTruth *GroundTruth) error {
+	_, enclaveVerification, err := attestConnection(ctx, conn, s.Enclave())
+	if err != nil {
+		return err
+	}
+	backend, err := s.backendGroundTruth(ctx, groundTruth, enclaveVerification)
+	if err != nil {
+		return err
+	}
+	s.addBackend(backend)
+	return nil
+}
+
+// backendGroundTruth checks a backend's verified attestation against the release of the client's ground truth.
+// With a release policy, a backend running another allowed release, as during a rolling deploy, is matched against the candidate releases.
+func (s *SecureClient) backendGroundTruth(ctx context.Context, groundTruth *GroundTruth, enclaveVerification *attestation.Verification) (*GroundTruth, error) {
+	return withContext(ctx, func() (*GroundTruth, error) {
+		hwMeasurements := s.hardwareMeasurements
+		var hwErr error
+		if enclaveVerification.Measurement.Type == attestation.TdxGuestV2 && len(hwMeasurements) == 0 {
+			hwMeasurements, hwErr = s.fetchHardwareMeasurements()
+		}
+
+		code := &release{tag: groundTruth.Tag, digest: groundTruth.Digest, measurement: groundTruth.CodeMeasurement, provenance: groundTruth.Provenance}
+		if s.codeMeasurement == nil && s.hasReleasePolicy() &&
+			(code.measurement == nil || code.measurement.Equals(enclaveVerification.Measurement) != nil) {
+			tags, err := s.backendCandidates()
+			if err != nil {
+				return nil, err
+			}
+			code, err = s.matchRelease(tags, enclaveVerification.Measurement)
+			if err != nil {
+				return nil, err
+			}
+		} else if err := s.checkReleaseAge(code); err != nil {
+			return nil, fmt.Errorf("verifyCode: %v", err)
+		}
+		return enclaveGroundTruth(s.Enclave(), code, enclaveVerification, hwMeasurements, hwErr)
+	})
+}
+
+// backendCandidates returns the release tags the ground truth was matched against,
+// or fetches them if the ground truth was restored from the store
+func (s *SecureClient) backendCandidates() ([]string, error) {
+	s.mu.RLock()
+	candidates := s.candidates
+	s.mu.RUnlock()
+	if candidates != nil {
+		return candidates, nil
+	}
+	return s.candidateTags()
+}
+
+// attestedRoundTripper sends requests over attested connections and, like TLSBoundRoundTripper,
+// rejects responses from connections whose key is not one of the verified backends
+type attestedRoundTripper struct {
+	client    *SecureClient
+	transport *http.Transport
+}
+
+func (t *attestedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TLS == nil {
+		resp.Body.Close()
+		return nil, ErrNoTLS
+	}
+	certFP, err := attestation.ConnectionCertFP(*resp.TLS)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if !t.client.verifiedBackend(certFP) {
+		resp.Body.Close()
+		return nil, ErrCertMismatch
+	}
+	return resp, nil
+}
+
+// initTransport creates the client's transport, whose connections are each attested by the enclave they reach.
+// It must exist before the first verification so that the connection the enclave is attested over is kept for it.
+// It keeps the proxy, timeout and HTTP/2 settings of http.DefaultTransport. Through an HTTP proxy, connections are
+// not dialed by the client and cannot be attested, so only backends verified over direct connections are accepted.
+func (s *SecureClient) initTransport() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == nil {
+		transport := defaultTransport()
+		transport.DialTLSContext = s.dialAttested
+		transport.TLSClientConfig = s.tlsConfig("")
+		s.transport = transport
+	}
+}
+
+// baseTransport returns the transport EHBP and signed response requests are sent over, or nil for http.DefaultTransport.
+// A client with its own roots or dialer gets a copy of http.DefaultTransport that uses them.
+func (s *SecureClient) baseTransport() http.RoundTripper {
+	if s.rootCAs == nil && s.dial == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bodyTransport == nil {
+		transport := defaultTransport()
+		transport.TLSClientConfig = s.tlsConfig("")
+		if s.dial != nil {
+			transport.DialContext = s.dial
+		}
+		s.bodyTransport = transport
+	}
+	return s.bodyTransport
+}
+
+// defaultTransport returns a copy of http.DefaultTransport, keeping its proxy, timeout and HTTP/2 settings
+func defaultTransport() *http.Transport {
+	if base, ok := http.DefaultTransport.(*http.Transport); ok {
+		return base.Clone()
+	}
+	return &http.Transport{}
+}
+
+// tlsTransport returns a round tripper over the client's attested transport
+func (s *SecureClient) tlsTransport() http.RoundTripper {
+	s.initTransport()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &attestedRoundTripper{client: s, transport: s.transport}
+}
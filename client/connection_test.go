@@ -0,0 +1,282 @@
+//go:build !wasm
+// +build !wasm
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	gh "github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+func TestSecureClientUsesAttestedConnection(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path+" from "+r.RemoteAddr)
+		mu.Unlock()
+		if r.URL.Path == "/.well-known/tinfoil-attestation" {
+			w.Write([]byte(`{"format":"https://tinfoil.sh/predicate/sev-snp-guest/v2","body":""}`))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	// A fresh client attests the enclave over its own connection, as verify does
+	var client *SecureClient
+	var attestedAddr string
+	var dials atomic.Int32
+	client = NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(
+		withDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return enclaves.dial(ctx, network, addr)
+		}),
+		withVerify(func(enclave string) (*GroundTruth, error) {
+			conn, err := client.dialEnclave(context.Background(), enclaveAddr(enclave))
+			if err != nil {
+				return nil, err
+			}
+			if _, err := attestation.FetchFromConn(conn, enclave); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			attestedAddr = conn.LocalAddr().String()
+			client.keepAttestedConn(conn, enclaveAddr(enclave))
+			return pinned.groundTruth, nil
+		}),
+	)...)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("/", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(resp.Body))
+	}
+
+	// The attestation and all requests went over the same connection
+	assert.Equal(t, int32(1), dials.Load())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"/.well-known/tinfoil-attestation from " + attestedAddr,
+		"/ from " + attestedAddr,
+		"/ from " + attestedAddr,
+		"/ from " + attestedAddr,
+	}, requests)
+}
+
+func TestSecureClientVerifiesNewBackend(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+
+	// The stand-in presents a key other than the verified one, as a second backend behind a load balancer would
+	client.groundTruth.TLSPublicKey = "other-backend"
+	_, err := client.Get("/v1/models", nil)
+	assert.ErrorIs(t, err, ErrCertMismatch)
+	assert.ErrorContains(t, err, "failed to verify backend")
+
+	// The backend was asked for its attestation instead of receiving the request
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/.well-known/tinfoil-attestation"}, paths)
+}
+
+func TestSecureClientBackends(t *testing.T) {
+	primary := &GroundTruth{TLSPublicKey: "a"}
+	client := &SecureClient{groundTruth: primary}
+	assert.True(t, client.verifiedBackend("a"))
+	assert.False(t, client.verifiedBackend("b"))
+
+	backend := &GroundTruth{TLSPublicKey: "b"}
+	client.addBackend(backend)
+	assert.True(t, client.verifiedBackend("b"))
+	assert.Equal(t, []*GroundTruth{primary, backend}, client.Backends())
+}
+
+func TestSecureClientReverifyResetsBackends(t *testing.T) {
+	client := NewSecureClient("enclave.example.com", "tinfoilsh/test", withVerify(func(string) (*GroundTruth, error) {
+		return &GroundTruth{TLSPublicKey: "a"}, nil
+	}))
+	client.addBackend(&GroundTruth{TLSPublicKey: "b"})
+
+	_, err := client.Verify()
+	require.NoError(t, err)
+	assert.False(t, client.verifiedBackend("b"))
+	assert.Len(t, client.Backends(), 1)
+}
+
+func TestDialEnclaveHTTP1(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	conn, err := client.dialEnclave(context.Background(), client.Enclave())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+}
+
+func TestAttestConnectionHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer close(release)
+
+	conn, err := client.dialEnclave(context.Background(), client.Enclave())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = attestConnection(ctx, conn, client.Enclave())
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestSecureClientBackendsOnAllowedReleases(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]any{{"tag_name": "v1.2.0"}, {"tag_name": "v1.1.0"}, {"tag_name": "v1.0.0"}})
+	}))
+	defer github.Close()
+
+	codeMeasurement := func(tag string) *attestation.Measurement {
+		return &attestation.Measurement{Type: attestation.SnpTdxMultiPlatformV1, Registers: []string{"snp-" + tag, "rtmr1", "rtmr2"}}
+	}
+	backend := func(key, tag string) *attestation.Verification {
+		return &attestation.Verification{
+			Measurement:    &attestation.Measurement{Type: attestation.SevGuestV2, Registers: []string{"snp-" + tag}},
+			TLSPublicKeyFP: key,
+		}
+	}
+	sigstoreClient, err := sigstore.NewClientFromJSON(embeddedTrustedRoot)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	newClient := func(opts ...Option) (*SecureClient, *[]string) {
+		var verified []string
+		client := NewSecureClient("enclave.example.com", "org/repo", append(opts,
+			WithGitHubSource(&gh.Source{APIURL: github.URL}),
+			withVerifyTag(func(_ *sigstore.Client, tag string) (*release, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				verified = append(verified, tag)
+				return &release{tag: tag, digest: "digest-" + tag, measurement: codeMeasurement(tag)}, nil
+			}),
+		)...)
+		client.sigstore = &sigstoreLoader{client: sigstoreClient}
+		return client, &verified
+	}
+	ctx := context.Background()
+	groundTruth := &GroundTruth{Tag: "v1.2.0", Digest: "digest-v1.2.0", CodeMeasurement: codeMeasurement("v1.2.0")}
+
+	client, verified := newClient(WithLastReleases(2))
+
+	// A backend on the ground truth's release needs no release lookup
+	current, err := client.backendGroundTruth(ctx, groundTruth, backend("a", "v1.2.0"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", current.Tag)
+	assert.Empty(t, *verified)
+
+	// A backend still on the previous allowed release during a rolling deploy is accepted
+	previous, err := client.backendGroundTruth(ctx, groundTruth, backend("b", "v1.1.0"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", previous.Tag)
+	assert.Equal(t, "digest-v1.1.0", previous.Digest)
+	assert.Equal(t, "b", previous.TLSPublicKey)
+	assert.ElementsMatch(t, []string{"v1.2.0", "v1.1.0"}, *verified)
+
+	// Another backend on a verified release reuses the cached release
+	again, err := client.backendGroundTruth(ctx, groundTruth, backend("d", "v1.1.0"))
+	require.NoError(t, err)
+	assert.Equal(t, "digest-v1.1.0", again.Digest)
+	assert.Len(t, *verified, 2)
+
+	// A release outside the policy is rejected
+	_, err = client.backendGroundTruth(ctx, groundTruth, backend("c", "v1.0.0"))
+	assert.ErrorContains(t, err, "no allowed release matches the enclave")
+
+	// Without a release policy only the ground truth's release is accepted
+	strict, verified := newClient()
+	_, err = strict.backendGroundTruth(ctx, groundTruth, backend("b", "v1.1.0"))
+	assert.ErrorContains(t, err, "measurements")
+	assert.Empty(t, *verified)
+
+	// The dial context bounds the lookup
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.backendGroundTruth(cancelled, groundTruth, backend("e", "v1.1.0"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSecureClientKeepsAttestedConnOnlyForHTTP(t *testing.T) {
+	client := NewSecureClient("enclave.example.com", "tinfoilsh/test")
+	addr := enclaveAddr(client.Enclave())
+
+	// Without the HTTP transport nothing would pick the connection up
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	client.keepAttestedConn(conn, addr)
+	assert.Nil(t, client.takePendingConn(addr))
+	_, err := conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+	client.tlsTransport()
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+	client.keepAttestedConn(conn, addr)
+	assert.Same(t, conn, client.takePendingConn(addr))
+}
+
+func TestSecureClientDropsStalePendingConn(t *testing.T) {
+	var client *SecureClient
+	var conn net.Conn
+	client = NewSecureClient("enclave.example.com", "tinfoilsh/test", withVerify(func(enclave string) (*GroundTruth, error) {
+		client.keepAttestedConn(conn, enclaveAddr(enclave))
+		return nil, errors.New("code measurement mismatch")
+	}))
+	addr := enclaveAddr(client.Enclave())
+	client.tlsTransport()
+
+	// A connection kept for longer than the bound may have been closed by the server
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	client.keepAttestedConn(conn, addr)
+	client.mu.Lock()
+	client.pendingAt = time.Now().Add(-2 * pendingConnMaxAge)
+	client.mu.Unlock()
+	assert.Nil(t, client.takePendingConn(addr))
+	_, err := conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+	// A connection attested during a verification that then fails is not used
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	_, err = client.Verify()
+	require.Error(t, err)
+	assert.Nil(t, client.takePendingConn(addr))
+	_, err = conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
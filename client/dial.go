@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// TLSConfig verifies the enclave and returns a TLS config that only accepts connections
+// presenting the attested TLS public key. Use it with any library that accepts a *tls.Config.
+// Unlike the HTTP client, it does not support multiple backends behind the enclave hostname: a backend presenting
+// another key fails the handshake with ErrCertMismatch until Verify is called again.
+func (s *SecureClient) TLSConfig() (*tls.Config, error) {
+	groundTruth, err := s.sharedVerify(true)
+	if err != nil {
+		return nil, err
+	}
+	return s.pinnedTLSConfig(hostname(s.Enclave()), groundTruth.TLSPublicKey)
+}
+
+// DialContext verifies the enclave and opens a TLS connection whose certificate carries the attested public key.
+// The returned connection is a *tls.Conn with the handshake completed. If addr is empty, the enclave's HTTPS port is dialed.
+// The signature matches net.Dialer.DialContext so it can be used as a dial function by other libraries.
+// Like TLSConfig, it only accepts the verified ground truth's key, so a connection reaching another backend fails with ErrCertMismatch.
+func (s *SecureClient) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if addr == "" {
+		addr = s.Enclave()
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "443")
+		}
+	}
+
+	groundTruth, err := s.sharedVerifyContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.pinnedTLSConfig(hostname(addr), groundTruth.TLSPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.dialTLS(ctx, network, addr, config)
+}
+
+// tlsConfig returns a TLS config for connections to the enclave at serverName
+func (s *SecureClient) tlsConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    s.rootCAs,
+	}
+}
+
+// pinnedTLSConfig returns a TLS config for serverName that rejects any certificate without the expected public key
+func (s *SecureClient) pinnedTLSConfig(serverName, expectedPublicKey string) (*tls.Config, error) {
+	if expectedPublicKey == "" {
+		return nil, ErrNoValidCertificate
+	}
+	config := s.tlsConfig(serverName)
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		certFP, err := attestation.ConnectionCertFP(state)
+		if err != nil {
+			return err
+		}
+		if certFP != expectedPublicKey {
+			return ErrCertMismatch
+		}
+		return nil
+	}
+	return config, nil
+}
+
+// dialTLS opens a TLS connection to addr over the client's dialer and completes the handshake
+func (s *SecureClient) dialTLS(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
+	if s.dial == nil {
+		conn, err := (&tls.Dialer{Config: config}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(*tls.Conn), nil
+	}
+
+	rawConn, err := s.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(rawConn, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hostname strips the port from an address, if there is one
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureClientTLSConfig(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	config, err := client.TLSConfig()
+	require.NoError(t, err)
+	conn, err := tls.Dial("tcp", client.Enclave(), config)
+	require.NoError(t, err)
+	conn.Close()
+
+	client.groundTruth.TLSPublicKey = "attested-key"
+	config, err = client.TLSConfig()
+	require.NoError(t, err)
+	_, err = tls.Dial("tcp", client.Enclave(), config)
+	assert.ErrorIs(t, err, ErrCertMismatch)
+}
+
+func TestSecureClientDialContext(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("raw"))
+	}))
+
+	conn, err := client.DialContext(context.Background(), "tcp", "")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, ok := conn.(*tls.Conn)
+	assert.True(t, ok)
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+client.Enclave()+"/", nil)
+	require.NoError(t, err)
+	require.NoError(t, req.Write(conn))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(body))
+}
+
+func TestSecureClientDialContextKeyMismatch(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client.groundTruth.TLSPublicKey = "attested-key"
+
+	_, err := client.DialContext(context.Background(), "tcp", client.Enclave())
+	assert.ErrorIs(t, err, ErrCertMismatch)
+}
@@ -0,0 +1,287 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// EHBP (Encrypted HTTP Body Protocol) encrypts HTTP bodies end-to-end to the enclave's attested HPKE key.
+//
+// The request body is sent as a sequence of frames, each a 4-byte big-endian length followed by an
+// HPKE ciphertext sealed with the request context. The encapsulated key is carried in the
+// Ehbp-Encapsulated-Key header. The enclave encrypts the response body with keys derived from a
+// secret exported from the request context and the nonce in the Ehbp-Response-Nonce header,
+// using the same framing.
+//
+// Frames are authenticated and ordered by the HPKE sequence number. A body ends with an end-of-body frame, an empty
+// plaintext sealed with its own additional data, so a body cut off by an intermediary at a frame boundary fails to
+// read instead of reading as complete. Data frames are never empty, so the end-of-body frame is the only frame whose
+// ciphertext is a bare AEAD tag. The client asks for end-of-body frames with the Ehbp-End-Of-Body header, terminates
+// its request body, and rejects responses that do not confirm the header.
+const (
+	EHBPEncapsulatedKeyHeader = "Ehbp-Encapsulated-Key"
+	EHBPResponseNonceHeader   = "Ehbp-Response-Nonce"
+	EHBPEndOfBodyHeader       = "Ehbp-End-Of-Body"
+
+	ehbpRequestInfo     = "ehbp request"
+	ehbpResponseLabel   = "ehbp response"
+	ehbpResponseNonceSz = 32
+	ehbpEndOfBodyAAD    = "ehbp end of body"
+
+	ehbpChunkSize    = 16 * 1024
+	ehbpMaxFrameSize = 16 * 1024 * 1024
+)
+
+var (
+	ErrNoHPKEKey             = errors.New("no attested HPKE public key")
+	ErrUnencryptedResponse   = errors.New("enclave response is not EHBP encrypted")
+	ErrInvalidEHBPFrame      = errors.New("invalid EHBP frame")
+	ErrInvalidResponseNonce  = errors.New("invalid EHBP response nonce")
+	ErrEHBPDecryptionFailure = errors.New("EHBP decryption failed")
+	ErrEHBPTruncated         = errors.New("EHBP body ended without an end-of-body frame")
+	ErrEHBPNoEndOfBody       = errors.New("enclave does not send EHBP end-of-body frames")
+	errEHBPBodyNotReplayable = errors.New("EHBP request body cannot be replayed")
+)
+
+// EHBPTransport encrypts request bodies to the enclave's attested HPKE public key and decrypts
+// the enclave's responses. It does not require the TLS connection to terminate in the enclave.
+type EHBPTransport struct {
+	// PublicKey is the hex-encoded X25519 HPKE public key of the enclave
+	PublicKey string
+	// Base is the underlying transport. http.DefaultTransport is used if nil.
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = &EHBPTransport{}
+
+func (t *EHBPTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *EHBPTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if len(t.PublicKey) == 0 {
+		return nil, ErrNoHPKEKey
+	}
+	keyBytes, err := hex.DecodeString(t.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding HPKE public key: %w", err)
+	}
+	pkR, err := ecdh.X25519().NewPublicKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing HPKE public key: %w", err)
+	}
+
+	ctx, enc, err := hpkeSetupBaseS(pkR, []byte(ehbpRequestInfo))
+	if err != nil {
+		return nil, err
+	}
+
+	req := r.Clone(r.Context())
+	req.Header.Set(EHBPEncapsulatedKeyHeader, hex.EncodeToString(enc))
+	req.Header.Set(EHBPEndOfBodyHeader, "1")
+	if r.Body != nil && r.Body != http.NoBody {
+		req.Body = &ehbpEncryptReader{src: r.Body, ctx: ctx}
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+		req.GetBody = func() (io.ReadCloser, error) {
+			return nil, errEHBPBodyNotReplayable
+		}
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceHex := resp.Header.Get(EHBPResponseNonceHeader)
+	if nonceHex == "" {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnencryptedResponse, resp.Status)
+	}
+	responseNonce, err := hex.DecodeString(nonceHex)
+	if err != nil || len(responseNonce) != ehbpResponseNonceSz {
+		resp.Body.Close()
+		return nil, ErrInvalidResponseNonce
+	}
+	if resp.Header.Get(EHBPEndOfBodyHeader) != "1" {
+		resp.Body.Close()
+		return nil, ErrEHBPNoEndOfBody
+	}
+
+	respCtx, err := ehbpResponseContext(ctx, enc, responseNonce)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	resp.Body = &ehbpDecryptReader{
+		src:    resp.Body,
+		reader: bufio.NewReader(resp.Body),
+		ctx:    respCtx,
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// ehbpResponseContext derives the response encryption context from the request context
+func ehbpResponseContext(reqCtx *hpkeContext, enc, responseNonce []byte) (*hpkeContext, error) {
+	secret, err := reqCtx.Export([]byte(ehbpResponseLabel), hpkeNk)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte{}, enc...), responseNonce...)
+	prk, err := hkdf.Extract(sha256.New, secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Expand(sha256.New, prk, "key", hpkeNk)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "nonce", hpkeNn)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &hpkeContext{aead: aead, baseNonce: nonce}, nil
+}
+
+// appendEHBPFrame seals plaintext with aad and appends it to dst as a length-prefixed frame
+func appendEHBPFrame(dst []byte, ctx *hpkeContext, aad, plaintext []byte) ([]byte, error) {
+	ciphertext, err := ctx.Seal(aad, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(ciphertext)))
+	return append(dst, ciphertext...), nil
+}
+
+// ehbpEncryptReader encrypts each chunk read from src into a length-prefixed frame and ends the body with the
+// end-of-body frame once src is read to the end
+type ehbpEncryptReader struct {
+	src     io.ReadCloser
+	ctx     *hpkeContext
+	chunk   []byte
+	pending bytes.Buffer
+	err     error
+}
+
+func (e *ehbpEncryptReader) Read(p []byte) (int, error) {
+	for e.pending.Len() == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+
+		if e.chunk == nil {
+			e.chunk = make([]byte, ehbpChunkSize)
+		}
+		n, err := e.src.Read(e.chunk)
+		var frames []byte
+		var sealErr error
+		if n > 0 {
+			frames, sealErr = appendEHBPFrame(frames, e.ctx, nil, e.chunk[:n])
+		}
+		// A body whose source fails is left unterminated, so the enclave rejects it
+		if sealErr == nil && err == io.EOF {
+			frames, sealErr = appendEHBPFrame(frames, e.ctx, []byte(ehbpEndOfBodyAAD), nil)
+		}
+		if sealErr != nil {
+			return 0, sealErr
+		}
+		e.pending.Write(frames)
+		if err != nil {
+			e.err = err
+		}
+	}
+	return e.pending.Read(p)
+}
+
+func (e *ehbpEncryptReader) Close() error {
+	return e.src.Close()
+}
+
+// ehbpDecryptReader decrypts length-prefixed frames from src
+type ehbpDecryptReader struct {
+	src     io.Closer
+	reader  *bufio.Reader
+	ctx     *hpkeContext
+	pending bytes.Buffer
+	err     error
+}
+
+func (d *ehbpDecryptReader) Read(p []byte) (int, error) {
+	for d.pending.Len() == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		plaintext, err := readEHBPFrame(d.reader, d.ctx)
+		if err != nil {
+			d.err = err
+			continue
+		}
+		d.pending.Write(plaintext)
+	}
+	return d.pending.Read(p)
+}
+
+func (d *ehbpDecryptReader) Close() error {
+	return d.src.Close()
+}
+
+// readEHBPFrame reads and opens a single frame. It returns io.EOF after the end-of-body frame,
+// and ErrEHBPTruncated if the body ends at a frame boundary without one.
+func readEHBPFrame(r io.Reader, ctx *hpkeContext) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		switch err {
+		case io.EOF:
+			return nil, ErrEHBPTruncated
+		case io.ErrUnexpectedEOF:
+			return nil, ErrInvalidEHBPFrame
+		}
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:])
+	if length == 0 || length > ehbpMaxFrameSize {
+		return nil, ErrInvalidEHBPFrame
+	}
+	ciphertext := make([]byte, length)
+	if _, err := io.ReadFull(r, ciphertext); err != nil {
+		return nil, ErrInvalidEHBPFrame
+	}
+
+	if len(ciphertext) == ctx.aead.Overhead() {
+		if _, err := ctx.Open([]byte(ehbpEndOfBodyAAD), ciphertext); err != nil {
+			return nil, ErrEHBPDecryptionFailure
+		}
+		// Nothing may follow the end of the body
+		var trailing [1]byte
+		if _, err := io.ReadFull(r, trailing[:]); err != io.EOF {
+			return nil, ErrInvalidEHBPFrame
+		}
+		return nil, io.EOF
+	}
+
+	plaintext, err := ctx.Open(nil, ciphertext)
+	if err != nil {
+		return nil, ErrEHBPDecryptionFailure
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hpkeSetupBaseR creates a receiver context from an encapsulated key
+func hpkeSetupBaseR(enc []byte, skR *ecdh.PrivateKey, info []byte) (*hpkeContext, error) {
+	pkE, err := ecdh.X25519().NewPublicKey(enc)
+	if err != nil {
+		return nil, err
+	}
+	dh, err := skR.ECDH(pkE)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := kemSharedSecret(dh, enc, skR.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return hpkeKeySchedule(sharedSecret, info)
+}
+
+// openEHBPRequest decrypts the body of an EHBP request as the enclave does and returns it
+// with a response nonce and the response context derived from it
+func openEHBPRequest(t *testing.T, skR *ecdh.PrivateKey, r *http.Request) ([]byte, []byte, *hpkeContext) {
+	assert.Equal(t, "1", r.Header.Get(EHBPEndOfBodyHeader))
+	enc, err := hex.DecodeString(r.Header.Get(EHBPEncapsulatedKeyHeader))
+	require.NoError(t, err)
+	ctx, err := hpkeSetupBaseR(enc, skR, []byte(ehbpRequestInfo))
+	require.NoError(t, err)
+
+	var body []byte
+	if r.ContentLength != 0 {
+		reader := bufio.NewReader(r.Body)
+		for {
+			plaintext, err := readEHBPFrame(reader, ctx)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			body = append(body, plaintext...)
+		}
+	}
+
+	responseNonce := make([]byte, ehbpResponseNonceSz)
+	_, err = rand.Read(responseNonce)
+	require.NoError(t, err)
+	respCtx, err := ehbpResponseContext(ctx, enc, responseNonce)
+	require.NoError(t, err)
+	return body, responseNonce, respCtx
+}
+
+// ehbpEnclaveHandler is a stand-in for an enclave EHBP server. It decrypts the request body
+// and passes it to the handler, then encrypts the handler's response body one word per frame.
+func ehbpEnclaveHandler(t *testing.T, skR *ecdh.PrivateKey, handler func(r *http.Request, body []byte) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, responseNonce, respCtx := openEHBPRequest(t, skR, r)
+
+		w.Header().Set(EHBPResponseNonceHeader, hex.EncodeToString(responseNonce))
+		w.Header().Set(EHBPEndOfBodyHeader, "1")
+		for _, chunk := range strings.SplitAfter(handler(r, body), " ") {
+			frame, err := appendEHBPFrame(nil, respCtx, nil, []byte(chunk))
+			require.NoError(t, err)
+			w.Write(frame)
+		}
+		frame, err := appendEHBPFrame(nil, respCtx, []byte(ehbpEndOfBodyAAD), nil)
+		require.NoError(t, err)
+		w.Write(frame)
+	}
+}
+
+func newHPKEKey(t *testing.T) *ecdh.PrivateKey {
+	sk, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return sk
+}
+
+func TestEHBPTransportRoundTrip(t *testing.T) {
+	skR := newHPKEKey(t)
+
+	var wireBody []byte
+	enclave := httptest.NewServer(ehbpEnclaveHandler(t, skR, func(r *http.Request, body []byte) string {
+		return "echo: " + string(body)
+	}))
+	defer enclave.Close()
+
+	// Record what an intermediary sees on the wire
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		wireBody, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		r.Body = io.NopCloser(bytes.NewReader(wireBody))
+		r.RequestURI = ""
+		target, _ := url.Parse(enclave.URL)
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	httpClient := &http.Client{
+		Transport: &EHBPTransport{PublicKey: hex.EncodeToString(skR.PublicKey().Bytes())},
+	}
+	resp, err := httpClient.Post(proxy.URL, "text/plain", strings.NewReader("secret prompt"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "echo: secret prompt", string(body))
+	assert.NotContains(t, string(wireBody), "secret prompt")
+}
+
+func TestEHBPTransportWrongKey(t *testing.T) {
+	enclave := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(EHBPResponseNonceHeader, strings.Repeat("00", ehbpResponseNonceSz))
+		w.Header().Set(EHBPEndOfBodyHeader, "1")
+		w.Write([]byte{0, 0, 0, 20})
+		w.Write(bytes.Repeat([]byte{1}, 20))
+	}))
+	defer enclave.Close()
+
+	httpClient := &http.Client{
+		Transport: &EHBPTransport{PublicKey: hex.EncodeToString(newHPKEKey(t).PublicKey().Bytes())},
+	}
+	resp, err := httpClient.Get(enclave.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, ErrEHBPDecryptionFailure)
+}
+
+func TestEHBPTransportUnencryptedResponse(t *testing.T) {
+	enclave := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plaintext"))
+	}))
+	defer enclave.Close()
+
+	httpClient := &http.Client{
+		Transport: &EHBPTransport{PublicKey: hex.EncodeToString(newHPKEKey(t).PublicKey().Bytes())},
+	}
+	_, err := httpClient.Get(enclave.URL)
+	assert.ErrorIs(t, err, ErrUnencryptedResponse)
+}
+
+func TestEHBPTransportEndOfBody(t *testing.T) {
+	skR := newHPKEKey(t)
+	respond := func(write func(w http.ResponseWriter, respCtx *hpkeContext)) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, responseNonce, respCtx := openEHBPRequest(t, skR, r)
+			w.Header().Set(EHBPResponseNonceHeader, hex.EncodeToString(responseNonce))
+			w.Header().Set(EHBPEndOfBodyHeader, "1")
+			write(w, respCtx)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	frame := func(respCtx *hpkeContext, aad, plaintext []byte) []byte {
+		frame, err := appendEHBPFrame(nil, respCtx, aad, plaintext)
+		require.NoError(t, err)
+		return frame
+	}
+	get := func(url string) ([]byte, error) {
+		httpClient := &http.Client{Transport: &EHBPTransport{PublicKey: hex.EncodeToString(skR.PublicKey().Bytes())}}
+		resp, err := httpClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	// A response cut off at a frame boundary is rejected instead of read as complete
+	truncated := respond(func(w http.ResponseWriter, respCtx *hpkeContext) {
+		w.Write(frame(respCtx, nil, []byte("partial")))
+	})
+	_, err := get(truncated.URL)
+	assert.ErrorIs(t, err, ErrEHBPTruncated)
+
+	// The end-of-body frame is sealed with its own additional data, so a data frame cannot stand in for it
+	forged := respond(func(w http.ResponseWriter, respCtx *hpkeContext) {
+		w.Write(frame(respCtx, nil, []byte{}))
+	})
+	_, err = get(forged.URL)
+	assert.ErrorIs(t, err, ErrEHBPDecryptionFailure)
+
+	// Nothing may follow the end of the body
+	trailing := respond(func(w http.ResponseWriter, respCtx *hpkeContext) {
+		w.Write(frame(respCtx, nil, []byte("complete")))
+		w.Write(frame(respCtx, []byte(ehbpEndOfBodyAAD), nil))
+		w.Write(frame(respCtx, nil, []byte("appended")))
+	})
+	_, err = get(trailing.URL)
+	assert.ErrorIs(t, err, ErrInvalidEHBPFrame)
+
+	// An empty body still ends with the end-of-body frame
+	empty := respond(func(w http.ResponseWriter, respCtx *hpkeContext) {
+		w.Write(frame(respCtx, []byte(ehbpEndOfBodyAAD), nil))
+	})
+	body, err := get(empty.URL)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// An enclave that does not confirm end-of-body frames is rejected before its body is read
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, responseNonce, respCtx := openEHBPRequest(t, skR, r)
+		w.Header().Set(EHBPResponseNonceHeader, hex.EncodeToString(responseNonce))
+		w.Write(frame(respCtx, nil, []byte("unterminated")))
+	}))
+	defer legacy.Close()
+	_, err = get(legacy.URL)
+	assert.ErrorIs(t, err, ErrEHBPNoEndOfBody)
+}
+
+func TestEHBPRequestEndOfBody(t *testing.T) {
+	skR := newHPKEKey(t)
+	sender, enc, err := hpkeSetupBaseS(skR.PublicKey(), []byte(ehbpRequestInfo))
+	require.NoError(t, err)
+	recipient, err := hpkeSetupBaseR(enc, skR, []byte(ehbpRequestInfo))
+	require.NoError(t, err)
+
+	// A request body whose source fails midway is left unterminated, so the enclave rejects it
+	body := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	wire, err := io.ReadAll(&ehbpEncryptReader{src: io.NopCloser(body), ctx: sender})
+	assert.Error(t, err)
+
+	reader := bytes.NewReader(wire)
+	plaintext, err := readEHBPFrame(reader, recipient)
+	require.NoError(t, err)
+	assert.Equal(t, "partial", string(plaintext))
+	_, err = readEHBPFrame(reader, recipient)
+	assert.ErrorIs(t, err, ErrEHBPTruncated)
+}
+
+func TestSecureClientEHBP(t *testing.T) {
+	skR := newHPKEKey(t)
+
+	// The stand-in's TLS certificate is not attested, as with a TLS-terminating proxy
+	enclaves, pinned := newTestEnclave(t, ehbpEnclaveHandler(t, skR, func(r *http.Request, body []byte) string {
+		return r.Method + " " + r.URL.Path + " " + string(body)
+	}))
+	client := NewSecureClient(pinned.Enclave(), "tinfoilsh/test", enclaves.options(WithEHBP())...)
+	client.groundTruth = &GroundTruth{
+		EnclaveHost:   pinned.Enclave(),
+		TLSPublicKey:  "not-the-proxy-key",
+		HPKEPublicKey: hex.EncodeToString(skR.PublicKey().Bytes()),
+	}
+
+	resp, err := client.Post("/v1/chat/completions", map[string]string{"Content-Type": "application/json"}, []byte(`{"stream":true}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `POST /v1/chat/completions {"stream":true}`, string(resp.Body))
+}
@@ -4,15 +4,15 @@
 package client
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/tinfoilsh/verifier/attestation"
 )
 
-// enclaveValidPubKey checks if the public key covered by the attestation matches the public key of the enclave
-func enclaveValidPubKey(enclave string, enclaveVerification *attestation.Verification) error {
+// enclaveTLSPublicKey connects to the enclave and returns the fingerprint of its TLS public key
+func (s *SecureClient) enclaveTLSPublicKey(enclave string) (string, error) {
 	// Get cert from TLS connection
 	var addr string
 	if strings.Contains(enclave, ":") {
@@ -23,16 +23,20 @@ func enclaveValidPubKey(enclave string, enclaveVerification *attestation.Verific
 		addr = enclave + ":443"
 	}
 
-	conn, err := tls.Dial("tcp", addr, &tls.Config{})
+	conn, err := s.dialTLS(context.Background(), "tcp", addr, s.tlsConfig(hostname(addr)))
 	if err != nil {
-		return fmt.Errorf("failed to connect to enclave: %v", err)
+		return "", fmt.Errorf("failed to connect to enclave: %v", err)
 	}
 	defer conn.Close()
 	certFP, err := attestation.ConnectionCertFP(conn.ConnectionState())
 	if err != nil {
-		return fmt.Errorf("failed to get certificate fingerprint: %v", err)
+		return "", fmt.Errorf("failed to get certificate fingerprint: %v", err)
 	}
+	return certFP, nil
+}
 
+// enclaveValidPubKey checks if the public key covered by the attestation matches the public key of the enclave
+func enclaveValidPubKey(certFP string, enclaveVerification *attestation.Verification) error {
 	// Check if the certificate fingerprint matches the one in the verification
 	if certFP != enclaveVerification.TLSPublicKeyFP {
 		return fmt.Errorf("certificate fingerprint mismatch: expected %s, got %s", enclaveVerification.TLSPublicKeyFP, certFP)
@@ -5,12 +5,45 @@ package client
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 
 	"github.com/tinfoilsh/verifier/attestation"
 )
 
-// enclaveValidPubKey is disabled in WASM builds since tls.Dial is not available
-func enclaveValidPubKey(enclave string, enclaveVerification *attestation.Verification) error {
+// enclaveTLSPublicKey is disabled in WASM builds since tls.Dial is not available
+func (s *SecureClient) enclaveTLSPublicKey(enclave string) (string, error) {
 	fmt.Printf("Warning: TLS certificate validation for enclave %s is disabled in WASM build\n", enclave)
+	return "", nil
+}
+
+// enclaveValidPubKey is disabled in WASM builds since the enclave's TLS public key cannot be read
+func enclaveValidPubKey(certFP string, enclaveVerification *attestation.Verification) error {
 	return nil
 }
+
+// attestEnclave fetches and verifies the enclave's attestation. WASM builds cannot open TLS connections,
+// so the attestation cannot be bound to the connection's key.
+func (s *SecureClient) attestEnclave(enclave string) (net.Conn, *attestation.Document, *attestation.Verification, error) {
+	fmt.Printf("Warning: TLS certificate validation for enclave %s is disabled in WASM build\n", enclave)
+	enclaveAttestation, enclaveVerification, err := verifyEnclave(enclave)
+	return nil, enclaveAttestation, enclaveVerification, err
+}
+
+// enclaveAddr returns the enclave's address; WASM builds have no attested connections to match it against
+func enclaveAddr(enclave string) string {
+	return enclave
+}
+
+// initTransport does nothing in WASM builds, which have no attested connections to keep
+func (s *SecureClient) initTransport() {}
+
+// baseTransport returns nil in WASM builds, whose requests are made by the browser's fetch API
+func (s *SecureClient) baseTransport() http.RoundTripper {
+	return nil
+}
+
+// tlsTransport pins the verified TLS key, which the browser's fetch API does not expose
+func (s *SecureClient) tlsTransport() http.RoundTripper {
+	return &TLSBoundRoundTripper{ExpectedPublicKey: s.GroundTruth().TLSPublicKey}
+}
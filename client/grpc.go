@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// EnclaveAuthInfo is the gRPC AuthInfo of a connection to a verified enclave
+type EnclaveAuthInfo struct {
+	credentials.TLSInfo
+	GroundTruth *GroundTruth
+}
+
+// TransportCredentials are gRPC transport credentials that verify the enclave serving the target
+// authority and pin its attested TLS public key during the handshake. Each authority is pinned to a single backend's key:
+// a handshake with another backend behind the same authority fails with ErrCertMismatch until its client verifies again.
+type TransportCredentials struct {
+	repo string
+	opts []Option
+
+	mu      sync.Mutex
+	clients map[string]*SecureClient
+}
+
+var _ credentials.TransportCredentials = &TransportCredentials{}
+
+// NewTransportCredentials creates gRPC transport credentials that verify each target authority against repo
+func NewTransportCredentials(repo string, opts ...Option) *TransportCredentials {
+	return &TransportCredentials{
+		repo:    repo,
+		opts:    opts,
+		clients: map[string]*SecureClient{},
+	}
+}
+
+// Client returns the secure client that verifies the given authority
+func (c *TransportCredentials) Client(authority string) *SecureClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[authority]
+	if !ok {
+		client = NewSecureClient(authority, c.repo, c.opts...)
+		c.clients[authority] = client
+	}
+	return client
+}
+
+// ClientHandshake verifies the enclave serving authority, then performs a TLS handshake
+// and checks that the enclave presented the attested TLS public key. It returns once ctx is done,
+// leaving a verification in progress to finish for the next handshake.
+func (c *TransportCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	client := c.Client(authority)
+	groundTruth, err := client.sharedVerifyContext(ctx, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify enclave: %v", err)
+	}
+	config, err := client.pinnedTLSConfig(hostname(authority), groundTruth.TLSPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.NextProtos = []string{"h2"}
+
+	conn := tls.Client(rawConn, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, &EnclaveAuthInfo{
+		TLSInfo: credentials.TLSInfo{
+			State:          conn.ConnectionState(),
+			CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		},
+		GroundTruth: groundTruth,
+	}, nil
+}
+
+// ServerHandshake is not supported; the credentials are for clients only
+func (c *TransportCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("enclave transport credentials cannot be used by servers")
+}
+
+func (c *TransportCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls"}
+}
+
+// Clone returns a copy of the credentials. The copy starts with the clients verified so far,
+// but authorities it verifies later are not shared with c.
+func (c *TransportCredentials) Clone() credentials.TransportCredentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clients := make(map[string]*SecureClient, len(c.clients))
+	for authority, client := range c.clients {
+		clients[authority] = client
+	}
+	return &TransportCredentials{
+		repo:    c.repo,
+		opts:    append([]Option(nil), c.opts...),
+		clients: clients,
+	}
+}
+
+// OverrideServerName is not supported, since the verified enclave is determined by the authority
+func (c *TransportCredentials) OverrideServerName(string) error {
+	return errors.New("enclave transport credentials do not support overriding the server name")
+}
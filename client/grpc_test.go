@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+// newTestGRPCEnclave starts an in-process gRPC health server as an enclave stand-in and returns its address
+func newTestGRPCEnclave(t *testing.T) (*testEnclaves, string) {
+	enclaves := newTestEnclaves(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&enclaves.cert)))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	enclaves.add(lis.Addr().String())
+	return enclaves, lis.Addr().String()
+}
+
+func checkHealth(t *testing.T, addr string, creds credentials.TransportCredentials) (*peer.Peer, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var p peer.Peer
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+	if err != nil {
+		return nil, err
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	return &p, nil
+}
+
+func TestTransportCredentials(t *testing.T) {
+	enclaves, addr := newTestGRPCEnclave(t)
+	groundTruth := enclaves.groundTruth(addr)
+
+	creds := NewTransportCredentials("tinfoilsh/test", enclaves.options()...)
+
+	p, err := checkHealth(t, addr, creds)
+	require.NoError(t, err)
+	authInfo, ok := p.AuthInfo.(*EnclaveAuthInfo)
+	require.True(t, ok)
+	assert.Equal(t, groundTruth, authInfo.GroundTruth)
+	assert.Equal(t, "tls", authInfo.AuthType())
+}
+
+func TestTransportCredentialsClone(t *testing.T) {
+	enclaves, addr := newTestGRPCEnclave(t)
+
+	creds := NewTransportCredentials("tinfoilsh/test", enclaves.options()...)
+	_, err := checkHealth(t, addr, creds)
+	require.NoError(t, err)
+
+	clone, ok := creds.Clone().(*TransportCredentials)
+	require.True(t, ok)
+	assert.NotSame(t, creds, clone)
+	assert.Same(t, creds.Client(addr), clone.Client(addr))
+
+	// Authorities verified by the clone are not added to the original
+	other := clone.Client("other.example.com")
+	assert.NotSame(t, other, creds.Client("other.example.com"))
+
+	_, err = checkHealth(t, addr, clone)
+	assert.NoError(t, err)
+}
+
+func TestTransportCredentialsKeyMismatch(t *testing.T) {
+	enclaves, addr := newTestGRPCEnclave(t)
+
+	creds := NewTransportCredentials("tinfoilsh/test", enclaves.options(withVerify(func(enclave string) (*GroundTruth, error) {
+		return &GroundTruth{EnclaveHost: enclave, TLSPublicKey: "attested-key"}, nil
+	}))...)
+
+	_, err := checkHealth(t, addr, creds)
+	assert.ErrorContains(t, err, ErrCertMismatch.Error())
+}
+
+func TestTransportCredentialsVerifyFailure(t *testing.T) {
+	enclaves, addr := newTestGRPCEnclave(t)
+	enclaves.fail(addr, errors.New("measurement mismatch"))
+
+	creds := NewTransportCredentials("tinfoilsh/test", enclaves.options()...)
+
+	_, err := checkHealth(t, addr, creds)
+	assert.ErrorContains(t, err, "measurement mismatch")
+}
+
+func TestTransportCredentialsHandshakeContext(t *testing.T) {
+	enclaves, addr := newTestGRPCEnclave(t)
+
+	release := make(chan struct{})
+	creds := NewTransportCredentials("tinfoilsh/test", enclaves.options(withVerify(func(enclave string) (*GroundTruth, error) {
+		<-release
+		return enclaves.verify(enclave)
+	}))...)
+
+	// The handshake gives up on a slow verification once its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := creds.ClientHandshake(ctx, addr, nil)
+	assert.ErrorContains(t, err, context.Canceled.Error())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := creds.ClientHandshake(ctx, addr, nil)
+		errs <- err
+	}()
+	waitForVerifyWaiters(t, creds.Client(addr), 0)
+	cancel()
+	assert.ErrorContains(t, <-errs, context.Canceled.Error())
+
+	// The verification finishes in the background and is used by the next handshake
+	close(release)
+	_, err = checkHealth(t, addr, creds)
+	assert.NoError(t, err)
+}
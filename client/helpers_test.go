@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// newTestCertificate generates a self-signed ECDSA certificate for localhost
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, attestation.KeyFP(&key.PublicKey)
+}
+
+// testEnclaves are local TLS stand-ins for enclaves sharing a test certificate. Clients created with their options
+// trust the certificate and verify each stand-in to a ground truth pinned to its key, unless it is set to fail.
+type testEnclaves struct {
+	cert  tls.Certificate
+	keyFP string
+	roots *x509.CertPool
+
+	mu    sync.Mutex
+	hosts map[string]error
+	down  map[string]bool
+}
+
+func newTestEnclaves(t *testing.T) *testEnclaves {
+	cert, keyFP := newTestCertificate(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return &testEnclaves{cert: cert, keyFP: keyFP, roots: roots, hosts: map[string]error{}, down: map[string]bool{}}
+}
+
+// serveAll starts a stand-in per handler and returns their hosts
+func (e *testEnclaves) serveAll(t *testing.T, handlers ...http.Handler) []string {
+	var hosts []string
+	for _, handler := range handlers {
+		hosts = append(hosts, e.serve(t, handler))
+	}
+	return hosts
+}
+
+// serve starts a stand-in serving handler and returns its host
+func (e *testEnclaves) serve(t *testing.T, handler http.Handler) string {
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{e.cert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	e.add(u.Host)
+	return u.Host
+}
+
+// add registers a stand-in serving the test certificate at host
+func (e *testEnclaves) add(host string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hosts[host] = nil
+}
+
+// fail makes verifications of the stand-in at host fail with err, or succeed again if err is nil
+func (e *testEnclaves) fail(host string, err error) {
+	e.add(host)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hosts[host] = err
+}
+
+// setDown makes connections to the stand-in at host fail to dial, or dial again if down is false
+func (e *testEnclaves) setDown(host string, down bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.down[host] = down
+}
+
+func (e *testEnclaves) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	e.mu.Lock()
+	down := e.down[addr]
+	e.mu.Unlock()
+	if down {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+// groundTruth returns the ground truth of the stand-in at host
+func (e *testEnclaves) groundTruth(host string) *GroundTruth {
+	return &GroundTruth{EnclaveHost: host, TLSPublicKey: e.keyFP}
+}
+
+func (e *testEnclaves) verify(enclave string) (*GroundTruth, error) {
+	e.mu.Lock()
+	err, ok := e.hosts[enclave]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no stand-in for %s", enclave)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.groundTruth(enclave), nil
+}
+
+// options returns options that trust, dial and verify the stand-ins, followed by opts
+func (e *testEnclaves) options(opts ...Option) []Option {
+	return append([]Option{withRootCAs(e.roots), withDialer(e.dial), withVerify(e.verify)}, opts...)
+}
+
+// newTestEnclave starts a local TLS stand-in for an enclave and returns a client with the given options
+// whose ground truth is pinned to the stand-in's key
+func newTestEnclave(t *testing.T, handler http.Handler, opts ...Option) (*testEnclaves, *SecureClient) {
+	enclaves := newTestEnclaves(t)
+	host := enclaves.serve(t, handler)
+	client := NewSecureClient(host, "tinfoilsh/test", enclaves.options(opts...)...)
+	client.groundTruth = enclaves.groundTruth(host)
+	return enclaves, client
+}
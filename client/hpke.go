@@ -0,0 +1,195 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HPKE (RFC 9180) base mode with DHKEM(X25519, HKDF-SHA256), HKDF-SHA256 and AES-256-GCM
+const (
+	hpkeKemID  uint16 = 0x0020
+	hpkeKdfID  uint16 = 0x0001
+	hpkeAeadID uint16 = 0x0002
+
+	hpkeNk = 32 // AEAD key length
+	hpkeNn = 12 // AEAD nonce length
+	hpkeNh = 32 // KDF output length
+
+	hpkeModeBase byte = 0x00
+)
+
+var (
+	hpkeKemSuiteID = binary.BigEndian.AppendUint16([]byte("KEM"), hpkeKemID)
+	hpkeSuiteID    = binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16([]byte("HPKE"), hpkeKemID), hpkeKdfID), hpkeAeadID)
+
+	errHPKESeqOverflow = errors.New("hpke: message limit reached")
+)
+
+// hpkeContext is an HPKE encryption context shared by sender and receiver
+type hpkeContext struct {
+	aead           cipher.AEAD
+	baseNonce      []byte
+	exporterSecret []byte
+	seq            uint64
+}
+
+func labeledExtract(suiteID, salt []byte, label string, ikm []byte) ([]byte, error) {
+	labeledIKM := append([]byte("HPKE-v1"), suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, ikm...)
+	return hkdf.Extract(sha256.New, labeledIKM, salt)
+}
+
+func labeledExpand(suiteID, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeledInfo := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+	return hkdf.Expand(sha256.New, prk, string(labeledInfo), length)
+}
+
+// kemSharedSecret derives the DHKEM shared secret from a Diffie-Hellman output
+func kemSharedSecret(dh, enc, pkR []byte) ([]byte, error) {
+	kemContext := append(append([]byte{}, enc...), pkR...)
+	eaePRK, err := labeledExtract(hpkeKemSuiteID, nil, "eae_prk", dh)
+	if err != nil {
+		return nil, err
+	}
+	return labeledExpand(hpkeKemSuiteID, eaePRK, "shared_secret", kemContext, hpkeNh)
+}
+
+// hpkeEncap generates an ephemeral key pair and returns the shared secret and encapsulated key for pkR
+func hpkeEncap(pkR *ecdh.PublicKey) (sharedSecret, enc []byte, err error) {
+	skE, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hpkeEncapWithKey(skE, pkR)
+}
+
+// hpkeEncapWithKey returns the shared secret and encapsulated key for pkR using the ephemeral key skE,
+// which must not be used for another encapsulation
+func hpkeEncapWithKey(skE *ecdh.PrivateKey, pkR *ecdh.PublicKey) (sharedSecret, enc []byte, err error) {
+	dh, err := skE.ECDH(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc = skE.PublicKey().Bytes()
+	sharedSecret, err = kemSharedSecret(dh, enc, pkR.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return sharedSecret, enc, nil
+}
+
+// hpkeKeySchedule derives the encryption context for base mode
+func hpkeKeySchedule(sharedSecret, info []byte) (*hpkeContext, error) {
+	pskIDHash, err := labeledExtract(hpkeSuiteID, nil, "psk_id_hash", nil)
+	if err != nil {
+		return nil, err
+	}
+	infoHash, err := labeledExtract(hpkeSuiteID, nil, "info_hash", info)
+	if err != nil {
+		return nil, err
+	}
+	ksContext := append([]byte{hpkeModeBase}, pskIDHash...)
+	ksContext = append(ksContext, infoHash...)
+
+	secret, err := labeledExtract(hpkeSuiteID, sharedSecret, "secret", nil)
+	if err != nil {
+		return nil, err
+	}
+	key, err := labeledExpand(hpkeSuiteID, secret, "key", ksContext, hpkeNk)
+	if err != nil {
+		return nil, err
+	}
+	baseNonce, err := labeledExpand(hpkeSuiteID, secret, "base_nonce", ksContext, hpkeNn)
+	if err != nil {
+		return nil, err
+	}
+	exporterSecret, err := labeledExpand(hpkeSuiteID, secret, "exp", ksContext, hpkeNh)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &hpkeContext{
+		aead:           aead,
+		baseNonce:      baseNonce,
+		exporterSecret: exporterSecret,
+	}, nil
+}
+
+// hpkeSetupBaseS creates a sender context for the recipient public key and returns it with the encapsulated key
+func hpkeSetupBaseS(pkR *ecdh.PublicKey, info []byte) (*hpkeContext, []byte, error) {
+	sharedSecret, enc, err := hpkeEncap(pkR)
+	if err != nil {
+		return nil, nil, fmt.Errorf("hpke: encap: %w", err)
+	}
+	ctx, err := hpkeKeySchedule(sharedSecret, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctx, enc, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// xorNonce returns baseNonce XOR the big-endian encoding of seq
+func xorNonce(baseNonce []byte, seq uint64) []byte {
+	nonce := make([]byte, len(baseNonce))
+	copy(nonce, baseNonce)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+func (c *hpkeContext) nextNonce() ([]byte, error) {
+	if c.seq == ^uint64(0) {
+		return nil, errHPKESeqOverflow
+	}
+	nonce := xorNonce(c.baseNonce, c.seq)
+	c.seq++
+	return nonce, nil
+}
+
+// Seal encrypts and authenticates a message with the next sequence number
+func (c *hpkeContext) Seal(aad, plaintext []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// Open decrypts and authenticates a message with the next sequence number
+func (c *hpkeContext) Open(aad, ciphertext []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// Export derives a secret of the given length from the context
+func (c *hpkeContext) Export(exporterContext []byte, length int) ([]byte, error) {
+	return labeledExpand(hpkeSuiteID, c.exporterSecret, "sec", exporterContext, length)
+}
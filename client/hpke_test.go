@@ -0,0 +1,99 @@
+package client
+
+import (
+	"crypto/ecdh"
+	"crypto/sha3"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// hpkeDeriveKeyPair is DeriveKeyPair of DHKEM(X25519, HKDF-SHA256)
+func hpkeDeriveKeyPair(t *testing.T, ikm []byte) *ecdh.PrivateKey {
+	dkpPRK, err := labeledExtract(hpkeKemSuiteID, nil, "dkp_prk", ikm)
+	require.NoError(t, err)
+	sk, err := labeledExpand(hpkeKemSuiteID, dkpPRK, "sk", nil, 32)
+	require.NoError(t, err)
+	key, err := ecdh.X25519().NewPrivateKey(sk)
+	require.NoError(t, err)
+	return key
+}
+
+// drawInput reads a length byte and that many bytes from r
+func drawInput(t *testing.T, r io.Reader) []byte {
+	n := make([]byte, 1)
+	_, err := r.Read(n)
+	require.NoError(t, err)
+	b := make([]byte, n[0])
+	_, err = r.Read(b)
+	require.NoError(t, err)
+	return b
+}
+
+// The DHKEM is shared by every X25519 suite, so the RFC 9180 A.1.1 setup also checks our KEM
+func TestHPKEKnownAnswerKEM(t *testing.T) {
+	skR := hpkeDeriveKeyPair(t, mustHex(t, "6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037"))
+	assert.Equal(t, "3948cfe0ad1ddb695d780e59077195da6c56506b027329794ab02bca80815c4d", hex.EncodeToString(skR.PublicKey().Bytes()))
+	skE := hpkeDeriveKeyPair(t, mustHex(t, "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234"))
+	assert.Equal(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431", hex.EncodeToString(skE.PublicKey().Bytes()))
+
+	sharedSecret, enc, err := hpkeEncapWithKey(skE, skR.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431", hex.EncodeToString(enc))
+	assert.Equal(t, "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc", hex.EncodeToString(sharedSecret))
+}
+
+// TestHPKEKnownAnswer checks the base mode DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-256-GCM vector of the
+// CFRG HPKE test vectors. Encryptions and exports are checked in the accumulated form of the C2SP CCTV vectors:
+// inputs are drawn from an unkeyed SHAKE128 stream, and the outputs are hashed with SHAKE128.
+func TestHPKEKnownAnswer(t *testing.T) {
+	info := mustHex(t, "4f6465206f6e2061204772656369616e2055726e")
+	skR := hpkeDeriveKeyPair(t, mustHex(t, "dac33b0e9db1b59dbbea58d59a14e7b5896e9bdf98fad6891e99d1686492b9ee"))
+	assert.Equal(t, "430f4b9859665145a6b1ba274024487bd66f03a2dd577d7753c68d7d7d00c00c", hex.EncodeToString(skR.PublicKey().Bytes()))
+
+	skE := hpkeDeriveKeyPair(t, mustHex(t, "2cd7c601cefb3d42a62b04b7a9041494c06c7843818e0ce28a8f704ae7ab20f9"))
+	sharedSecret, enc, err := hpkeEncapWithKey(skE, skR.PublicKey())
+	require.NoError(t, err)
+	sender, err := hpkeKeySchedule(sharedSecret, info)
+	require.NoError(t, err)
+	assert.Equal(t, "6c93e09869df3402d7bf231bf540fadd35cd56be14f97178f0954db94b7fc256", hex.EncodeToString(enc))
+	recipient, err := hpkeSetupBaseR(enc, skR, info)
+	require.NoError(t, err)
+
+	source, sink := sha3.NewSHAKE128(), sha3.NewSHAKE128()
+	for range 1000 {
+		aad, plaintext := drawInput(t, source), drawInput(t, source)
+		ciphertext, err := sender.Seal(aad, plaintext)
+		require.NoError(t, err)
+		sink.Write(ciphertext)
+		opened, err := recipient.Open(aad, ciphertext)
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(plaintext), hex.EncodeToString(opened))
+	}
+	encryptions := make([]byte, 16)
+	sink.Read(encryptions)
+	assert.Equal(t, "1702e73e1e71705faa8241022af1deea", hex.EncodeToString(encryptions))
+
+	source, sink = sha3.NewSHAKE128(), sha3.NewSHAKE128()
+	for length := range 1000 {
+		exporterContext := drawInput(t, source)
+		exported, err := sender.Export(exporterContext, length)
+		require.NoError(t, err)
+		sink.Write(exported)
+		received, err := recipient.Export(exporterContext, length)
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(exported), hex.EncodeToString(received))
+	}
+	exports := make([]byte, 16)
+	sink.Read(exports)
+	assert.Equal(t, "5cb678bf1c52afbd9afb58b8f7c1ced3", hex.EncodeToString(exports))
+}
@@ -1,14 +1,73 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 )
 
+// Request describes an HTTP request to the enclave
+type Request struct {
+	Method string
+	// URL is either an absolute URL or a path relative to the enclave
+	URL    string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// HTTPRequest builds an *http.Request from the request description.
+// Query parameters are merged with any query already present in the URL.
+func (r *Request) HTTPRequest(ctx context.Context) (*http.Request, error) {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Query) > 0 {
+		query := u.Query()
+		for k, values := range r.Query {
+			for _, v := range values {
+				query.Add(k, v)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range r.Header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	return req, nil
+}
+
+// Response is a fully buffered HTTP response from the enclave
 type Response struct {
 	Status     string
 	StatusCode int
+	Header     http.Header
+	Trailer    http.Header
 	Body       []byte
+	// Enclave is the host that served the response
+	Enclave string
 }
 
 func toResponse(r *http.Response) (*Response, error) {
@@ -16,9 +75,128 @@ func toResponse(r *http.Response) (*Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	var enclave string
+	if r.Request != nil {
+		enclave = r.Request.URL.Host
+	}
+	// Trailers are only populated once the body has been read to EOF
 	return &Response{
 		Status:     r.Status,
 		StatusCode: r.StatusCode,
+		Header:     r.Header,
+		Trailer:    r.Trailer,
 		Body:       body,
+		Enclave:    enclave,
 	}, nil
 }
+
+// replayableBody returns a function that produces a fresh copy of the request body,
+// buffering the body if the request cannot replay it itself. It returns nil for requests without a body.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req.GetBody, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}, nil
+}
+
+// retargetRequest clones req with its URL pointed at enclave and a fresh body from getBody
+func retargetRequest(req *http.Request, enclave string, getBody func() (io.ReadCloser, error)) (*http.Request, error) {
+	attempt := req.Clone(req.Context())
+	attempt.URL.Scheme = "https"
+	attempt.URL.Host = enclave
+	attempt.Host = ""
+	if getBody != nil {
+		body, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+		attempt.GetBody = getBody
+	}
+	return attempt, nil
+}
+
+// notSentError is an error that occurred before any of the request was sent, such as a failed dial or attestation
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string { return e.err.Error() }
+func (e *notSentError) Unwrap() error { return e.err }
+
+// canRetry reports whether a request that failed with err may be sent again to another enclave. A request that may
+// have reached the enclave is only replayed if it is idempotent and its body, if any, can be replayed by the caller,
+// so that a POST is never processed twice.
+func canRetry(req *http.Request, replayable bool, err error) bool {
+	var notSent *notSentError
+	var opErr *net.OpError
+	if errors.As(err, &notSent) || (errors.As(err, &opErr) && opErr.Op == "dial") {
+		return true
+	}
+	return replayable && isIdempotent(req)
+}
+
+// isIdempotent reports whether the request has an idempotent method or an idempotency key, like net/http's retry rule
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// failover sends req to each client in turn until one responds, retargeting it at the client's enclave.
+// A client that fails is passed to failed. The request moves on to the next client only if it never reached the
+// failed one, or if replaying it is safe; otherwise, or once the request's context is done, the failover ends.
+func failover(req *http.Request, clients []*SecureClient, failed func(*SecureClient, error)) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, client := range clients {
+		attempt, err := retargetRequest(req, client.Enclave(), getBody)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(attempt)
+		if err == nil {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		failed(client, err)
+		errs = append(errs, fmt.Errorf("%s: %w", client.Enclave(), err))
+		if !canRetry(attempt, replayable, err) {
+			return nil, errors.Join(errs...)
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// sendBuffered makes the HTTP request described by r with do and buffers the response
+func sendBuffered(ctx context.Context, r *Request, do func(*http.Request) (*http.Response, error)) (*Response, error) {
+	req, err := r.HTTPRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return toResponse(resp)
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestHTTPRequest(t *testing.T) {
+	r := &Request{
+		URL:    "/v1/models?limit=10",
+		Query:  url.Values{"tag": {"a", "b"}},
+		Header: http.Header{"X-Tag": {"one", "two"}},
+	}
+
+	req, err := r.HTTPRequest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodGet, req.Method)
+	assert.Equal(t, "/v1/models", req.URL.Path)
+	assert.Equal(t, url.Values{"limit": {"10"}, "tag": {"a", "b"}}, req.URL.Query())
+	assert.Equal(t, []string{"one", "two"}, req.Header.Values("X-Tag"))
+	assert.Nil(t, req.Body)
+}
+
+func TestSecureClientMethods(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Request-Id", "req-123")
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write(body)
+		w.Header().Set("X-Checksum", "abc")
+	}))
+
+	for _, tc := range []struct {
+		method string
+		call   func() (*Response, error)
+		body   string
+	}{
+		{http.MethodGet, func() (*Response, error) { return client.Get("/", nil) }, ""},
+		{http.MethodPost, func() (*Response, error) { return client.Post("/", nil, []byte("post")) }, "post"},
+		{http.MethodPut, func() (*Response, error) { return client.Put("/", nil, []byte("put")) }, "put"},
+		{http.MethodPatch, func() (*Response, error) { return client.Patch("/", nil, []byte("patch")) }, "patch"},
+		{http.MethodDelete, func() (*Response, error) { return client.Delete("/", nil) }, ""},
+		{http.MethodHead, func() (*Response, error) { return client.Head("/", nil) }, ""},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			resp, err := tc.call()
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.method, resp.Header.Get("X-Method"))
+			assert.Equal(t, "req-123", resp.Header.Get("X-Request-Id"))
+			assert.Equal(t, tc.body, string(resp.Body))
+		})
+	}
+
+	resp, err := client.Send(context.Background(), &Request{
+		Method: http.MethodPost,
+		URL:    "/echo",
+		Body:   []byte("hello"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(resp.Body))
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+}
+
+func TestSecureClientSendQuery(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, []string{"a", "b"}, r.URL.Query()["tag"])
+		assert.Equal(t, []string{"Bearer x", "Bearer y"}, r.Header.Values("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	resp, err := client.Send(context.Background(), &Request{
+		URL:    "/search",
+		Query:  url.Values{"tag": {"a", "b"}},
+		Header: http.Header{"Authorization": {"Bearer x", "Bearer y"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
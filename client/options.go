@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/tinfoilsh/verifier/config"
+	"github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+// Option configures optional behaviour of a SecureClient
+type Option func(*SecureClient)
+
+// WithEHBP encrypts request and response bodies end-to-end to the enclave's attested HPKE key
+// instead of pinning the enclave's TLS certificate. Use this mode when a TLS-terminating proxy
+// sits between the client and the enclave. Headers and URLs are not encrypted. Bodies end with an authenticated
+// end-of-body frame, so a body truncated by the proxy fails to read, and the enclave must support it.
+func WithEHBP() Option {
+	return func(s *SecureClient) {
+		s.ehbp = true
+	}
+}
+
+// WithResponseSignatures verifies that every response is signed by the enclave's attested response signing key
+// instead of pinning the enclave's TLS certificate. Use this mode when a CDN or ingress terminates TLS in front
+// of the enclave. Headers are not authenticated, and a response body is only authenticated once it has been read
+// to the end. EHBP takes precedence if both are enabled, since it already authenticates response bodies.
+func WithResponseSignatures() Option {
+	return func(s *SecureClient) {
+		s.signedResponses = true
+	}
+}
+
+// WithGroundTruthStore restores the ground truth from store instead of running a full verification
+// when the stored entry is still valid, and saves the result of every full verification to it.
+// A restored ground truth is only used if the enclave still serves the attested TLS key, and only by clients with the
+// same identity policy, trusted roots, GitHub and OCI sources and hardware provider as the client that stored it.
+func WithGroundTruthStore(store GroundTruthStore) Option {
+	return func(s *SecureClient) {
+		s.store = store
+	}
+}
+
+// WithLatestDigestCheck only restores a stored ground truth if its digest is still the latest release of the repo
+func WithLatestDigestCheck() Option {
+	return func(s *SecureClient) {
+		s.checkLatestDigest = true
+	}
+}
+
+// WithReleaseTag verifies the enclave against the given release tag of the repo instead of the latest release.
+// It has no effect on clients with pinned measurements.
+func WithReleaseTag(tag string) Option {
+	return func(s *SecureClient) {
+		s.releaseTag = tag
+	}
+}
+
+// WithDigest verifies the enclave against the release with the given digest instead of the latest release.
+// The digest's attestation bundle is still verified with sigstore. Combined with WithReleaseTag, the attestation
+// must also have been built from that tag. It has no effect on clients with pinned measurements.
+func WithDigest(digest string) Option {
+	return func(s *SecureClient) {
+		s.releaseDigest = digest
+	}
+}
+
+// WithAllowedReleases accepts any release whose tag satisfies the allowed versions, such as one created
+// with config.New(">=1.4.0, <2"). Candidate releases are tried newest first and the matching tag is
+// recorded in the ground truth. It has no effect if a release tag or digest is pinned.
+func WithAllowedReleases(allowed *config.Config) Option {
+	return func(s *SecureClient) {
+		s.allowedReleases = allowed
+	}
+}
+
+// WithLastReleases accepts any of the repo's n most recent releases. Combined with WithAllowedReleases,
+// only the recent releases that satisfy the allowed versions are accepted.
+// It has no effect if a release tag or digest is pinned.
+func WithLastReleases(n int) Option {
+	return func(s *SecureClient) {
+		s.lastReleases = n
+	}
+}
+
+// WithMaxReleaseAge rejects releases whose attestation was recorded in the transparency log, or timestamped,
+// more than maxAge ago. Unlike WithLastReleases, which trusts the proxy's list of releases, this bounds how old a
+// release a proxy can roll the enclave back to. It has no effect on clients with pinned measurements.
+func WithMaxReleaseAge(maxAge time.Duration) Option {
+	return func(s *SecureClient) {
+		s.maxReleaseAge = maxAge
+	}
+}
+
+// WithIdentityPolicy requires the release's sigstore bundle to be signed by a workflow run matching the policy,
+// such as a single release workflow on semver tags run by a GitHub-hosted runner.
+// By default any workflow in the repo running on a tag is accepted.
+func WithIdentityPolicy(policy sigstore.IdentityPolicy) Option {
+	return func(s *SecureClient) {
+		s.identityPolicy = &policy
+	}
+}
+
+// WithTrustRootCacheDir caches the Sigstore TUF metadata in dir instead of the user's cache directory
+func WithTrustRootCacheDir(dir string) Option {
+	return func(s *SecureClient) {
+		s.trustRootCacheDir = dir
+	}
+}
+
+// WithTrustRoots verifies sigstore bundles against the given trusted roots instead of the Sigstore public good instance,
+// such as a private instance served from its own TUF mirror. A bundle verified by any of the roots is accepted;
+// include a zero sigstore.TrustRootOptions to keep accepting the public good instance.
+func WithTrustRoots(trustRoots ...sigstore.TrustRootOptions) Option {
+	return func(s *SecureClient) {
+		s.trustRoots = trustRoots
+	}
+}
+
+// WithGitHubSource fetches the repo's releases and attestations from src, such as github.NewGitHubSource(token)
+// for api.github.com or github.NewEnterpriseSource for GitHub Enterprise Server, instead of Tinfoil's proxies.
+// Hardware measurements are still fetched from the default source unless a sigstore.HardwareRepo with its own Source is configured.
+func WithGitHubSource(src *github.Source) Option {
+	return func(s *SecureClient) {
+		s.githubSource = src
+	}
+}
+
+// WithOCISource fetches the attestation bundles of a release from the OCI referrers of its image in repository,
+// such as ghcr.io/org/image, instead of the GitHub attestations API. Release tags and digests are still fetched from
+// the GitHub source, and the bundles must still be signed by a workflow of the repo and attest the digest.
+// Options such as remote.WithAuthFromKeychain(authn.DefaultKeychain) authenticate to private registries.
+func WithOCISource(repository string, opts ...remote.Option) Option {
+	return func(s *SecureClient) {
+		s.ociRepository = repository
+		s.ociOptions = opts
+	}
+}
+
+// WithHardwareProvider verifies TDX enclaves against the hardware measurements of provider instead of the latest release
+// of sigstore.DefaultHardwareRepo, such as a pinned sigstore.HardwareRepo, a sigstore.HardwareFile, or a sigstore.MergedHardware
+// of Tinfoil's repo and your own. It has no effect on clients with pinned hardware measurements.
+func WithHardwareProvider(provider sigstore.HardwareProvider) Option {
+	return func(s *SecureClient) {
+		s.hardwareProvider = provider
+	}
+}
+
+// WithHardwareCache reuses fetched hardware measurements for ttl instead of fetching them on every verification.
+// The cache is shared by the clients of a router pool or replica set.
+func WithHardwareCache(ttl time.Duration) Option {
+	return func(s *SecureClient) {
+		s.hardwareCacheTTL = ttl
+	}
+}
+
+// withRootCAs verifies enclave certificates against roots instead of the system roots
+func withRootCAs(roots *x509.CertPool) Option {
+	return func(s *SecureClient) {
+		s.rootCAs = roots
+	}
+}
+
+// withDialer opens the connections that TLS connections to the enclave run over with dial
+func withDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(s *SecureClient) {
+		s.dial = dial
+	}
+}
+
+// withVerify replaces the verification of the enclave with verify, for enclave stand-ins without attestation hardware
+func withVerify(verify func(enclave string) (*GroundTruth, error)) Option {
+	return func(s *SecureClient) {
+		s.verifyFunc = verify
+	}
+}
+
+// withVerifyTag replaces fetching and verifying a candidate release with verifyTag, for releases that are not signed
+func withVerifyTag(verifyTag func(sigstoreClient *sigstore.Client, tag string) (*release, error)) Option {
+	return func(s *SecureClient) {
+		s.verifyTagFunc = verifyTag
+	}
+}
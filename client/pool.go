@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNoVerifiedRouters = errors.New("no verified routers available")
+
+// RouterStatus describes the verification state of a router in a pool
+type RouterStatus struct {
+	Enclave    string
+	Verified   bool
+	Latency    time.Duration
+	VerifiedAt time.Time
+	Err        error
+}
+
+type poolRouter struct {
+	client *SecureClient
+
+	// Guarded by RouterPool.mu
+	status RouterStatus
+}
+
+// RouterPool verifies a set of routers running the same repo in parallel and sends each
+// request to the fastest verified router, failing over to the next one when a router is unreachable.
+type RouterPool struct {
+	mu      sync.RWMutex
+	routers []*poolRouter
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewRouterPool creates a pool of routers that are all verified against repo
+func NewRouterPool(routers []string, repo string, opts ...Option) *RouterPool {
+	var loader *sigstoreLoader
+	releases := &releaseCache{}
+	p := &RouterPool{}
+	for _, router := range routers {
+		client := NewSecureClient(router, repo, opts...)
+		if loader == nil {
+			loader = client.sharedSigstore()
+		}
+		client.sigstore = loader
+		client.releases = releases
+		p.routers = append(p.routers, &poolRouter{
+			client: client,
+			status: RouterStatus{Enclave: router},
+		})
+	}
+	return p
+}
+
+// NewDefaultRouterPool creates a pool from the routers published by the Tinfoil router service
+func NewDefaultRouterPool(opts ...Option) (*RouterPool, error) {
+	routers, err := fetchRouters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch routers: %v", err)
+	}
+	if len(routers) == 0 {
+		return nil, fmt.Errorf("router service returned no routers")
+	}
+	return NewRouterPool(routers, defaultRouterRepo, opts...), nil
+}
+
+// Verify verifies all routers in parallel and ranks the verified ones by latency.
+// It returns an error only if no router could be verified.
+func (p *RouterPool) Verify() error {
+	p.mu.RLock()
+	routers := append([]*poolRouter(nil), p.routers...)
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	statuses := make([]RouterStatus, len(routers))
+	for i, router := range routers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = verifyRouter(router.client)
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for i, router := range routers {
+		router.status = statuses[i]
+	}
+	p.rank()
+	p.mu.Unlock()
+
+	var errs []error
+	for _, status := range statuses {
+		if status.Verified {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", status.Enclave, status.Err))
+	}
+	return errors.Join(append([]error{ErrNoVerifiedRouters}, errs...)...)
+}
+
+// verifyRouter verifies a router and measures its latency with a request over the pinned connection
+func verifyRouter(client *SecureClient) RouterStatus {
+	status := RouterStatus{Enclave: client.Enclave()}
+	if _, err := client.Verify(); err != nil {
+		status.Err = err
+		return status
+	}
+
+	req, err := http.NewRequest(http.MethodHead, "/", nil)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	resp.Body.Close()
+
+	status.Verified = true
+	status.Latency = time.Since(start)
+	status.VerifiedAt = time.Now()
+	return status
+}
+
+// rank orders verified routers by latency ahead of unverified ones. Must be called with p.mu held.
+func (p *RouterPool) rank() {
+	sort.SliceStable(p.routers, func(i, j int) bool {
+		a, b := p.routers[i].status, p.routers[j].status
+		if a.Verified != b.Verified {
+			return a.Verified
+		}
+		return a.Latency < b.Latency
+	})
+}
+
+// Start re-verifies all routers in the background at the given interval until Close is called
+func (p *RouterPool) Start(interval time.Duration) {
+	p.mu.Lock()
+	if p.stop != nil {
+		p.mu.Unlock()
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	p.mu.Unlock()
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Verify()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops background re-verification
+func (p *RouterPool) Close() {
+	p.mu.RLock()
+	stop, done := p.stop, p.done
+	p.mu.RUnlock()
+	if stop == nil {
+		return
+	}
+	p.stopOnce.Do(func() { close(stop) })
+	<-done
+}
+
+// Routers returns the status of every router in the pool, best first
+func (p *RouterPool) Routers() []RouterStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]RouterStatus, len(p.routers))
+	for i, router := range p.routers {
+		statuses[i] = router.status
+	}
+	return statuses
+}
+
+// Client returns the secure client of the best verified router
+func (p *RouterPool) Client() (*SecureClient, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.routers) == 0 || !p.routers[0].status.Verified {
+		return nil, ErrNoVerifiedRouters
+	}
+	return p.routers[0].client, nil
+}
+
+// markFailed takes a router out of rotation until it is verified again
+func (p *RouterPool) markFailed(client *SecureClient, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, router := range p.routers {
+		if router.client == client {
+			router.status.Verified = false
+			router.status.Err = err
+		}
+	}
+	p.rank()
+}
+
+func (p *RouterPool) verifiedClients() []*SecureClient {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var clients []*SecureClient
+	for _, router := range p.routers {
+		if router.status.Verified {
+			clients = append(clients, router.client)
+		}
+	}
+	return clients
+}
+
+// Do sends the request to the best verified router. If the router cannot be reached or attested, the request
+// is retried on the next verified router; after it may have reached the router, only if it is idempotent and its
+// body can be replayed. The request URL's scheme and host are replaced with the router's; the router that served
+// the request is available from the response's Request.URL.Host.
+func (p *RouterPool) Do(req *http.Request) (*http.Response, error) {
+	clients := p.verifiedClients()
+	if len(clients) == 0 {
+		return nil, ErrNoVerifiedRouters
+	}
+	return failover(req, clients, p.markFailed)
+}
+
+// Send makes the HTTP request described by r on the best verified router and buffers the response
+func (p *RouterPool) Send(ctx context.Context, r *Request) (*Response, error) {
+	return sendBuffered(ctx, r, p.Do)
+}
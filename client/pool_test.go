@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPool creates a pool of local router stand-ins
+func newTestPool(t *testing.T, handlers ...http.Handler) (*RouterPool, *testEnclaves) {
+	enclaves := newTestEnclaves(t)
+	return NewRouterPool(enclaves.serveAll(t, handlers...), "tinfoilsh/test", enclaves.options()...), enclaves
+}
+
+func routerHandler(name string, delay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte(name))
+	}
+}
+
+func TestRouterPoolRanking(t *testing.T) {
+	pool, _ := newTestPool(t,
+		routerHandler("slow", 100*time.Millisecond),
+		routerHandler("fast", 0),
+	)
+	require.NoError(t, pool.Verify())
+
+	statuses := pool.Routers()
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Verified)
+	assert.True(t, statuses[1].Verified)
+	assert.Less(t, statuses[0].Latency, statuses[1].Latency)
+
+	resp, err := pool.Send(context.Background(), &Request{URL: "/v1/models"})
+	require.NoError(t, err)
+	assert.Equal(t, "fast", string(resp.Body))
+	assert.Equal(t, statuses[0].Enclave, resp.Enclave)
+}
+
+func TestRouterPoolFailover(t *testing.T) {
+	var hits atomic.Int32
+	pool, _ := newTestPool(t,
+		routerHandler("backup", 50*time.Millisecond),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) > 1 {
+				// Drop the connection after the latency probe
+				panic(http.ErrAbortHandler)
+			}
+		}),
+	)
+	require.NoError(t, pool.Verify())
+
+	primary := pool.Routers()[0].Enclave
+	backup := pool.Routers()[1].Enclave
+
+	// An idempotent request is retried even though the primary may have received it
+	resp, err := pool.Send(context.Background(), &Request{URL: "/v1/models"})
+	require.NoError(t, err)
+	assert.Equal(t, "backup", string(resp.Body))
+	assert.Equal(t, backup, resp.Enclave)
+
+	statuses := pool.Routers()
+	assert.Equal(t, backup, statuses[0].Enclave)
+	assert.Equal(t, primary, statuses[1].Enclave)
+	assert.False(t, statuses[1].Verified)
+	assert.Error(t, statuses[1].Err)
+}
+
+func TestRouterPoolNoReplayAfterSend(t *testing.T) {
+	var hits, backupHits atomic.Int32
+	pool, _ := newTestPool(t,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(50 * time.Millisecond)
+			backupHits.Add(1)
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) > 1 {
+				panic(http.ErrAbortHandler)
+			}
+		}),
+	)
+	require.NoError(t, pool.Verify())
+	backupHits.Store(0)
+
+	// The primary received the POST before failing, so it is not sent again to the backup
+	_, err := pool.Send(context.Background(), &Request{
+		Method: http.MethodPost,
+		URL:    "/v1/chat/completions",
+		Body:   []byte("hello"),
+	})
+	assert.Error(t, err)
+	assert.Zero(t, backupHits.Load())
+	assert.False(t, pool.Routers()[1].Verified)
+}
+
+func TestRouterPoolBackgroundReverify(t *testing.T) {
+	pool, enclaves := newTestPool(t, routerHandler("a", 0), routerHandler("b", 0))
+	require.NoError(t, pool.Verify())
+
+	failed := pool.routers[0].client
+	pool.Start(10 * time.Millisecond)
+	defer pool.Close()
+	enclaves.fail(failed.Enclave(), errors.New("attestation mismatch"))
+
+	assert.Eventually(t, func() bool {
+		for _, status := range pool.Routers() {
+			if status.Enclave == failed.Enclave() {
+				return !status.Verified
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		resp, err := pool.Send(context.Background(), &Request{URL: "/"})
+		require.NoError(t, err)
+		assert.NotEqual(t, failed.Enclave(), resp.Enclave)
+	}
+}
+
+func TestRouterPoolNoVerifiedRouters(t *testing.T) {
+	pool, enclaves := newTestPool(t, routerHandler("a", 0))
+	enclaves.fail(pool.routers[0].client.Enclave(), errors.New("attestation mismatch"))
+
+	err := pool.Verify()
+	assert.ErrorIs(t, err, ErrNoVerifiedRouters)
+	assert.ErrorContains(t, err, "attestation mismatch")
+
+	_, err = pool.Send(context.Background(), &Request{URL: "/"})
+	assert.ErrorIs(t, err, ErrNoVerifiedRouters)
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNoVerifiedReplicas = errors.New("no verified replicas available")
+
+type replica struct {
+	client *SecureClient
+
+	// Guarded by ReplicaSet.mu
+	verified bool
+	err      error
+}
+
+// ReplicaSet balances requests across enclave replicas of the same repo.
+// The code measurement is verified once and shared by all replicas, while each replica's
+// attestation is verified separately. Replicas that fail verification are evicted until the next Verify.
+type ReplicaSet struct {
+	repo     string
+	code     *codeLoader
+	releases *releaseCache
+
+	mu       sync.RWMutex
+	replicas []*replica
+
+	next atomic.Uint64
+}
+
+// NewReplicaSet creates a replica set of the given enclave hosts, all verified against repo
+func NewReplicaSet(hosts []string, repo string, opts ...Option) *ReplicaSet {
+	r := &ReplicaSet{
+		repo:     repo,
+		code:     &codeLoader{},
+		releases: &releaseCache{},
+	}
+	var loader *sigstoreLoader
+	for _, host := range hosts {
+		client := NewSecureClient(host, repo, opts...)
+		if loader == nil {
+			loader = client.sharedSigstore()
+		}
+		client.sigstore = loader
+		client.code = r.code
+		client.releases = r.releases
+		r.replicas = append(r.replicas, &replica{client: client})
+	}
+	return r
+}
+
+// Repo returns the repo all replicas are verified against
+func (r *ReplicaSet) Repo() string {
+	return r.repo
+}
+
+// Verify verifies the latest release of the repo and the attestation of every replica in parallel.
+// Replicas that fail verification are evicted. It returns an error only if no replica could be verified.
+func (r *ReplicaSet) Verify() error {
+	// Pick up a new release on every verification round
+	r.code.reset()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(r.replicas))
+	for i, replica := range r.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = replica.client.Verify()
+		}()
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var failures []error
+	for i, replica := range r.replicas {
+		replica.verified = errs[i] == nil
+		replica.err = errs[i]
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", replica.client.Enclave(), errs[i]))
+		}
+	}
+	if len(failures) == len(r.replicas) {
+		return errors.Join(append([]error{ErrNoVerifiedReplicas}, failures...)...)
+	}
+	return nil
+}
+
+// Replicas returns the hosts of the replicas currently in rotation
+func (r *ReplicaSet) Replicas() []string {
+	var hosts []string
+	for _, client := range r.verifiedClients() {
+		hosts = append(hosts, client.Enclave())
+	}
+	return hosts
+}
+
+// GroundTruths returns the ground truth of every verified replica, keyed by host
+func (r *ReplicaSet) GroundTruths() map[string]*GroundTruth {
+	groundTruths := map[string]*GroundTruth{}
+	for _, client := range r.verifiedClients() {
+		groundTruths[client.Enclave()] = client.GroundTruth()
+	}
+	return groundTruths
+}
+
+// Errors returns the verification error of every evicted replica, keyed by host
+func (r *ReplicaSet) Errors() map[string]error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	errs := map[string]error{}
+	for _, replica := range r.replicas {
+		if !replica.verified && replica.err != nil {
+			errs[replica.client.Enclave()] = replica.err
+		}
+	}
+	return errs
+}
+
+func (r *ReplicaSet) verifiedClients() []*SecureClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var clients []*SecureClient
+	for _, replica := range r.replicas {
+		if replica.verified {
+			clients = append(clients, replica.client)
+		}
+	}
+	return clients
+}
+
+// evict takes a replica out of rotation until the next Verify
+func (r *ReplicaSet) evict(client *SecureClient, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, replica := range r.replicas {
+		if replica.client == client {
+			replica.verified = false
+			replica.err = err
+		}
+	}
+}
+
+// Do sends the request to the next verified replica in round-robin order. A replica that fails is evicted.
+// The request is retried on the next replica if it never reached the failed one, or if it is idempotent and its
+// body can be replayed. The request URL's scheme and host are replaced with the replica's.
+func (r *ReplicaSet) Do(req *http.Request) (*http.Response, error) {
+	clients := r.verifiedClients()
+	if len(clients) == 0 {
+		return nil, ErrNoVerifiedReplicas
+	}
+
+	start := int((r.next.Add(1) - 1) % uint64(len(clients)))
+	clients = slices.Concat(clients[start:], clients[:start])
+	return failover(req, clients, r.evict)
+}
+
+// Send makes the HTTP request described by req on the next verified replica and buffers the response
+func (r *ReplicaSet) Send(ctx context.Context, req *Request) (*Response, error) {
+	return sendBuffered(ctx, req, r.Do)
+}
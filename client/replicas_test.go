@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// newTestReplicaSet creates a replica set of local enclave stand-ins
+func newTestReplicaSet(t *testing.T, handlers ...http.Handler) (*ReplicaSet, *testEnclaves) {
+	enclaves := newTestEnclaves(t)
+	return NewReplicaSet(enclaves.serveAll(t, handlers...), "tinfoilsh/test", enclaves.options()...), enclaves
+}
+
+func TestCodeLoaderShared(t *testing.T) {
+	loader := &codeLoader{}
+	verified := &release{
+		tag:         "v1.0.0",
+		digest:      "digest",
+		measurement: &attestation.Measurement{Type: attestation.SnpTdxMultiPlatformV1, Registers: []string{"a"}},
+	}
+
+	var calls atomic.Int32
+	verify := func() (*release, error) {
+		calls.Add(1)
+		return verified, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := loader.get(verify)
+			assert.NoError(t, err)
+			assert.Equal(t, verified, got)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	loader.reset()
+	_, err := loader.get(verify)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCodeLoaderFailureNotCached(t *testing.T) {
+	loader := &codeLoader{}
+	_, err := loader.get(func() (*release, error) {
+		return nil, errors.New("github unavailable")
+	})
+	assert.Error(t, err)
+
+	got, err := loader.get(func() (*release, error) {
+		return &release{digest: "digest", measurement: &attestation.Measurement{}}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "digest", got.digest)
+}
+
+func TestReplicaSetSharesCodeLoader(t *testing.T) {
+	replicas := NewReplicaSet([]string{"a.example.com", "b.example.com"}, "tinfoilsh/test")
+	require.Len(t, replicas.replicas, 2)
+	assert.Same(t, replicas.code, replicas.replicas[0].client.code)
+	assert.Same(t, replicas.code, replicas.replicas[1].client.code)
+	assert.Same(t, replicas.replicas[0].client.sigstore, replicas.replicas[1].client.sigstore)
+	assert.Same(t, replicas.releases, replicas.replicas[0].client.releases)
+	assert.Same(t, replicas.releases, replicas.replicas[1].client.releases)
+}
+
+func TestReleaseCacheShared(t *testing.T) {
+	cache := &releaseCache{}
+	var calls atomic.Int32
+	verify := func(tag string) func() (*release, error) {
+		return func() (*release, error) {
+			calls.Add(1)
+			return &release{tag: tag}, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, tag := range []string{"v1.0.0", "v1.1.0"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := cache.get(tag, verify(tag))
+				assert.NoError(t, err)
+				assert.Equal(t, tag, got.tag)
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Failures are verified again
+	_, err := cache.get("v1.2.0", func() (*release, error) { return nil, errors.New("github unavailable") })
+	assert.Error(t, err)
+	got, err := cache.get("v1.2.0", verify("v1.2.0"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", got.tag)
+}
+
+func TestReplicaSetRoundRobin(t *testing.T) {
+	replicas, _ := newTestReplicaSet(t, routerHandler("a", 0), routerHandler("b", 0), routerHandler("c", 0))
+	require.NoError(t, replicas.Verify())
+	assert.Len(t, replicas.Replicas(), 3)
+
+	served := map[string]int{}
+	for i := 0; i < 6; i++ {
+		resp, err := replicas.Send(context.Background(), &Request{URL: "/"})
+		require.NoError(t, err)
+		served[string(resp.Body)]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, served)
+
+	groundTruths := replicas.GroundTruths()
+	assert.Len(t, groundTruths, 3)
+	for host, groundTruth := range groundTruths {
+		assert.Equal(t, host, groundTruth.EnclaveHost)
+	}
+}
+
+func TestReplicaSetEvictsFailedAttestation(t *testing.T) {
+	replicas, enclaves := newTestReplicaSet(t, routerHandler("a", 0), routerHandler("b", 0))
+	evicted := replicas.replicas[1].client
+	enclaves.fail(evicted.Enclave(), errors.New("measurement mismatch"))
+
+	require.NoError(t, replicas.Verify())
+	assert.Equal(t, []string{replicas.replicas[0].client.Enclave()}, replicas.Replicas())
+	assert.NotContains(t, replicas.GroundTruths(), evicted.Enclave())
+	assert.ErrorContains(t, replicas.Errors()[evicted.Enclave()], "measurement mismatch")
+
+	for i := 0; i < 4; i++ {
+		resp, err := replicas.Send(context.Background(), &Request{URL: "/"})
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(resp.Body))
+	}
+}
+
+func TestReplicaSetEvictsUnreachable(t *testing.T) {
+	replicas, enclaves := newTestReplicaSet(t, routerHandler("a", 0), routerHandler("b", 0))
+	require.NoError(t, replicas.Verify())
+
+	// The second replica goes away, so requests to it fail to dial before anything is sent
+	unreachable := replicas.replicas[1].client.Enclave()
+	enclaves.setDown(unreachable, true)
+
+	for i := 0; i < 4; i++ {
+		resp, err := replicas.Send(context.Background(), &Request{Method: http.MethodPost, URL: "/", Body: []byte("x")})
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(resp.Body))
+	}
+	assert.Len(t, replicas.Replicas(), 1)
+	assert.Len(t, replicas.Errors(), 1)
+
+	// Evicted replicas rejoin on the next verification
+	enclaves.setDown(unreachable, false)
+	require.NoError(t, replicas.Verify())
+	assert.Len(t, replicas.Replicas(), 2)
+}
+
+func TestReplicaSetNoReplayAfterSend(t *testing.T) {
+	var aHits atomic.Int32
+	replicas, _ := newTestReplicaSet(t,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			aHits.Add(1)
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}),
+	)
+	require.NoError(t, replicas.Verify())
+
+	post := &Request{Method: http.MethodPost, URL: "/", Body: []byte("x")}
+	_, err := replicas.Send(context.Background(), post)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), aHits.Load())
+
+	// The second replica received the POST before dropping the connection, so it is not replayed on the first
+	_, err = replicas.Send(context.Background(), post)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), aHits.Load())
+	assert.Len(t, replicas.Replicas(), 1)
+}
+
+func TestReplicaSetNoVerifiedReplicas(t *testing.T) {
+	replicas, enclaves := newTestReplicaSet(t, routerHandler("a", 0))
+	enclaves.fail(replicas.replicas[0].client.Enclave(), errors.New("measurement mismatch"))
+
+	err := replicas.Verify()
+	assert.ErrorIs(t, err, ErrNoVerifiedReplicas)
+	assert.ErrorContains(t, err, "measurement mismatch")
+
+	_, err = replicas.Send(context.Background(), &Request{URL: "/"})
+	assert.ErrorIs(t, err, ErrNoVerifiedReplicas)
+}
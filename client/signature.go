@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Response signatures authenticate enclave responses when TLS terminates outside the enclave.
+//
+// The client sends a random nonce in the Tinfoil-Signature-Nonce header. The enclave signs the
+// ResponseSignatureDigest of the request and response with the Ed25519 key committed in its
+// attestation, and sends the base64-encoded signature in the Tinfoil-Signature trailer, or in a
+// header if the response is not streamed.
+const (
+	ResponseSignatureNonceHeader = "Tinfoil-Signature-Nonce"
+	ResponseSignatureHeader      = "Tinfoil-Signature"
+
+	responseSignatureDomain  = "tinfoil response signature v1"
+	responseSignatureNonceSz = 32
+)
+
+var (
+	ErrNoSigningKey             = errors.New("no attested response signing key")
+	ErrMissingResponseSignature = errors.New("enclave response is not signed")
+	ErrInvalidResponseSignature = errors.New("invalid enclave response signature")
+)
+
+// ResponseSignatureDigest returns the digest an enclave signs for a response. It binds the client's nonce,
+// the request method, URI and body hash, and the response status and body hash.
+func ResponseSignatureDigest(nonce []byte, method, requestURI string, requestBodyHash []byte, statusCode int, responseBodyHash []byte) []byte {
+	h := sha256.New()
+	for _, field := range [][]byte{
+		[]byte(responseSignatureDomain),
+		nonce,
+		[]byte(method),
+		[]byte(requestURI),
+		requestBodyHash,
+		[]byte(strconv.Itoa(statusCode)),
+		responseBodyHash,
+	} {
+		h.Write([]byte(strconv.Itoa(len(field)) + ":"))
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+// SignedResponseTransport verifies that responses are signed by the enclave's attested response signing key.
+// It does not require the TLS connection to terminate in the enclave. Response bodies are streamed,
+// so a body is only authenticated once it has been read to the end: reading returns an error instead
+// of io.EOF if the signature is missing or invalid.
+type SignedResponseTransport struct {
+	// SigningPublicKey is the hex-encoded Ed25519 response signing key of the enclave
+	SigningPublicKey string
+	// Base is the underlying transport. http.DefaultTransport is used if nil.
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = &SignedResponseTransport{}
+
+func (t *SignedResponseTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *SignedResponseTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if len(t.SigningPublicKey) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	publicKey, err := hex.DecodeString(t.SigningPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signing public key: %w", err)
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing public key length: %d", len(publicKey))
+	}
+
+	req := r.Clone(r.Context())
+	requestBodyHash := sha256.New()
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		requestBodyHash.Write(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	nonce := make([]byte, responseSignatureNonceSz)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	req.Header.Set(ResponseSignatureNonceHeader, hex.EncodeToString(nonce))
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &signedBodyReader{
+		body:            resp.Body,
+		hash:            sha256.New(),
+		resp:            resp,
+		publicKey:       publicKey,
+		nonce:           nonce,
+		method:          req.Method,
+		requestURI:      req.URL.RequestURI(),
+		requestBodyHash: requestBodyHash.Sum(nil),
+	}
+	return resp, nil
+}
+
+// signedBodyReader hashes the response body as it is read and checks the signature at the end of the body
+type signedBodyReader struct {
+	body io.ReadCloser
+	hash hash.Hash
+	resp *http.Response
+
+	publicKey       ed25519.PublicKey
+	nonce           []byte
+	method          string
+	requestURI      string
+	requestBodyHash []byte
+
+	err error
+}
+
+func (b *signedBodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		// Trailers are only populated once the body has been read to EOF
+		if verifyErr := b.verify(); verifyErr != nil {
+			err = verifyErr
+		}
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *signedBodyReader) verify() error {
+	encoded := b.resp.Trailer.Get(ResponseSignatureHeader)
+	if encoded == "" {
+		encoded = b.resp.Header.Get(ResponseSignatureHeader)
+	}
+	if encoded == "" {
+		return ErrMissingResponseSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidResponseSignature
+	}
+
+	digest := ResponseSignatureDigest(b.nonce, b.method, b.requestURI, b.requestBodyHash, b.resp.StatusCode, b.hash.Sum(nil))
+	if !ed25519.Verify(b.publicKey, digest, signature) {
+		return ErrInvalidResponseSignature
+	}
+	return nil
+}
+
+func (b *signedBodyReader) Close() error {
+	return b.body.Close()
+}
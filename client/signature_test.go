@@ -0,0 +1,146 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signingEnclaveHandler is a stand-in for an enclave that signs its responses. The response body
+// is written by write, and the signature is sent in a trailer.
+func signingEnclaveHandler(t *testing.T, key ed25519.PrivateKey, write func(w http.ResponseWriter, r *http.Request, body []byte) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := hex.DecodeString(r.Header.Get(ResponseSignatureNonceHeader))
+		require.NoError(t, err)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requestBodyHash := sha256.Sum256(body)
+
+		w.Header().Set("Trailer", ResponseSignatureHeader)
+		responseBody := write(w, r, body)
+		responseBodyHash := sha256.Sum256([]byte(responseBody))
+
+		digest := ResponseSignatureDigest(nonce, r.Method, r.URL.RequestURI(), requestBodyHash[:], http.StatusOK, responseBodyHash[:])
+		w.Header().Set(ResponseSignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(key, digest)))
+	}
+}
+
+func echoSigned(w http.ResponseWriter, r *http.Request, body []byte) string {
+	response := r.Method + " " + r.URL.RequestURI() + " " + string(body)
+	io.WriteString(w, response)
+	return response
+}
+
+func newSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return publicKey, privateKey
+}
+
+func TestSignedResponseTransport(t *testing.T) {
+	publicKey, privateKey := newSigningKey(t)
+	server := httptest.NewServer(signingEnclaveHandler(t, privateKey, echoSigned))
+	defer server.Close()
+
+	httpClient := &http.Client{
+		Transport: &SignedResponseTransport{SigningPublicKey: hex.EncodeToString(publicKey)},
+	}
+	resp, err := httpClient.Post(server.URL+"/v1/chat?stream=true", "text/plain", strings.NewReader("prompt"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "POST /v1/chat?stream=true prompt", string(body))
+}
+
+func TestSignedResponseTransportWrongKey(t *testing.T) {
+	_, privateKey := newSigningKey(t)
+	otherKey, _ := newSigningKey(t)
+	server := httptest.NewServer(signingEnclaveHandler(t, privateKey, echoSigned))
+	defer server.Close()
+
+	httpClient := &http.Client{
+		Transport: &SignedResponseTransport{SigningPublicKey: hex.EncodeToString(otherKey)},
+	}
+	resp, err := httpClient.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, ErrInvalidResponseSignature)
+}
+
+func TestSignedResponseTransportTamperedBody(t *testing.T) {
+	publicKey, privateKey := newSigningKey(t)
+	server := httptest.NewServer(signingEnclaveHandler(t, privateKey, func(w http.ResponseWriter, r *http.Request, body []byte) string {
+		// A terminator in front of the enclave rewrites the body after it was signed
+		io.WriteString(w, "tampered")
+		return "original"
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{
+		Transport: &SignedResponseTransport{SigningPublicKey: hex.EncodeToString(publicKey)},
+	}
+	resp, err := httpClient.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, ErrInvalidResponseSignature)
+}
+
+func TestSignedResponseTransportUnsigned(t *testing.T) {
+	publicKey, _ := newSigningKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unsigned"))
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{
+		Transport: &SignedResponseTransport{SigningPublicKey: hex.EncodeToString(publicKey)},
+	}
+	resp, err := httpClient.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, ErrMissingResponseSignature)
+}
+
+func TestSecureClientResponseSignatures(t *testing.T) {
+	publicKey, privateKey := newSigningKey(t)
+
+	// The stand-in's TLS certificate is not attested, as with a TLS-terminating CDN
+	enclaves, pinned := newTestEnclave(t, signingEnclaveHandler(t, privateKey, echoSigned))
+	client := NewSecureClient(pinned.Enclave(), "tinfoilsh/test", enclaves.options(WithResponseSignatures())...)
+	client.groundTruth = &GroundTruth{
+		EnclaveHost:      pinned.Enclave(),
+		TLSPublicKey:     "not-the-cdn-key",
+		SigningPublicKey: hex.EncodeToString(publicKey),
+	}
+
+	resp, err := client.Post("/v1/chat/completions", nil, []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "POST /v1/chat/completions hello", string(resp.Body))
+}
+
+func TestSecureClientResponseSignaturesNoKey(t *testing.T) {
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client := NewSecureClient(pinned.Enclave(), "tinfoilsh/test", enclaves.options(WithResponseSignatures())...)
+	client.groundTruth = &GroundTruth{EnclaveHost: pinned.Enclave()}
+
+	_, err := client.Get("/", nil)
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+var (
+	ErrGroundTruthNotFound = errors.New("no stored ground truth")
+	ErrGroundTruthExpired  = errors.New("stored ground truth expired")
+	ErrGroundTruthTampered = errors.New("stored ground truth failed integrity check")
+)
+
+// GroundTruthStore persists verified ground truths keyed by enclave and repo.
+// Clients with a non-default verification policy pass the repo qualified by a fingerprint of the policy.
+type GroundTruthStore interface {
+	// Load returns the stored ground truth, or ErrGroundTruthNotFound if there is none
+	Load(enclave, repo string) (*GroundTruth, error)
+	Save(enclave, repo string, groundTruth *GroundTruth) error
+}
+
+// FileStore stores ground truths as files in a directory. Entries are authenticated with
+// an HMAC key kept alongside them, which detects casual edits but not an attacker who can read the key.
+type FileStore struct {
+	dir string
+	ttl time.Duration
+	key []byte
+}
+
+var _ GroundTruthStore = &FileStore{}
+
+type fileStoreEntry struct {
+	Enclave     string          `json:"enclave"`
+	Repo        string          `json:"repo"`
+	VerifiedAt  time.Time       `json:"verified_at"`
+	GroundTruth json.RawMessage `json:"ground_truth"`
+	MAC         string          `json:"mac"`
+}
+
+const fileStoreKeySz = 32
+
+// NewFileStore opens a ground truth store in dir, creating it and its HMAC key if needed.
+// Entries older than ttl are treated as missing; ttl must be positive.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid store TTL %v: must be positive", ttl)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %v", err)
+	}
+
+	keyPath := filepath.Join(dir, "key")
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, fileStoreKeySz)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(keyPath, key); err != nil {
+			return nil, fmt.Errorf("failed to write store key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read store key: %v", err)
+	}
+	if len(key) != fileStoreKeySz {
+		return nil, fmt.Errorf("invalid store key length: %d", len(key))
+	}
+
+	return &FileStore{dir: dir, ttl: ttl, key: key}, nil
+}
+
+// DefaultFileStore opens a store in the user's cache directory, with entries expiring after ttl
+func DefaultFileStore(ttl time.Duration) (*FileStore, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileStore(filepath.Join(cacheDir, "tinfoil", "ground-truth"), ttl)
+}
+
+func (f *FileStore) path(enclave, repo string) string {
+	name := sha256.Sum256([]byte(enclave + "\x00" + repo))
+	return filepath.Join(f.dir, hex.EncodeToString(name[:])+".json")
+}
+
+func (f *FileStore) mac(e *fileStoreEntry) string {
+	h := hmac.New(sha256.New, f.key)
+	for _, field := range [][]byte{
+		[]byte(e.Enclave),
+		[]byte(e.Repo),
+		[]byte(strconv.FormatInt(e.VerifiedAt.UnixNano(), 10)),
+		e.GroundTruth,
+	} {
+		h.Write([]byte(strconv.Itoa(len(field)) + ":"))
+		h.Write(field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Load returns the stored ground truth for the enclave and repo if it is authentic and has not expired
+func (f *FileStore) Load(enclave, repo string) (*GroundTruth, error) {
+	data, err := os.ReadFile(f.path(enclave, repo))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrGroundTruthNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry fileStoreEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, ErrGroundTruthTampered
+	}
+	if !hmac.Equal([]byte(entry.MAC), []byte(f.mac(&entry))) {
+		return nil, ErrGroundTruthTampered
+	}
+	if entry.Enclave != enclave || entry.Repo != repo {
+		return nil, ErrGroundTruthTampered
+	}
+	if time.Since(entry.VerifiedAt) > f.ttl {
+		return nil, ErrGroundTruthExpired
+	}
+
+	var groundTruth GroundTruth
+	if err := json.Unmarshal(entry.GroundTruth, &groundTruth); err != nil {
+		return nil, ErrGroundTruthTampered
+	}
+	return &groundTruth, nil
+}
+
+// Save stores the ground truth for the enclave and repo
+func (f *FileStore) Save(enclave, repo string, groundTruth *GroundTruth) error {
+	groundTruthJSON, err := json.Marshal(groundTruth)
+	if err != nil {
+		return err
+	}
+	entry := &fileStoreEntry{
+		Enclave:     enclave,
+		Repo:        repo,
+		VerifiedAt:  time.Now().UTC(),
+		GroundTruth: groundTruthJSON,
+	}
+	entry.MAC = f.mac(entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path(enclave, repo), data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreGroundTruth loads the stored ground truth and re-checks the parts that are cheap to check:
+// the enclave still serves the attested TLS key and the verified digest is still the release to verify.
+// The digest is always checked against a pinned tag or digest, but against the latest release only if required.
+func (s *SecureClient) restoreGroundTruth() (*GroundTruth, error) {
+	enclave := s.Enclave()
+	repo, ok := s.storeRepo()
+	if !ok {
+		return nil, fmt.Errorf("the verification policy cannot be stored")
+	}
+	groundTruth, err := s.store.Load(enclave, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if groundTruth.EnclaveHost != enclave {
+		return nil, fmt.Errorf("stored ground truth is for %s", groundTruth.EnclaveHost)
+	}
+	if s.codeMeasurement != nil {
+		if err := s.codeMeasurement.Equals(groundTruth.CodeMeasurement); err != nil {
+			return nil, fmt.Errorf("stored code measurement does not match pinned measurement: %v", err)
+		}
+	}
+
+	// With EHBP or response signatures a changed enclave key makes responses fail to verify, so there is no TLS key to check
+	if s.pinsTLS() {
+		tlsPublicKey, err := s.enclaveTLSPublicKey(enclave)
+		if err != nil {
+			return nil, fmt.Errorf("validateTLS: %v", err)
+		}
+		if err := enclaveValidPubKey(tlsPublicKey, &attestation.Verification{TLSPublicKeyFP: groundTruth.TLSPublicKey}); err != nil {
+			return nil, fmt.Errorf("validateTLS: %v", err)
+		}
+	}
+
+	if s.codeMeasurement == nil {
+		if identity := s.identity(); identity != nil {
+			if err := identity.CheckProvenance(s.repo, groundTruth.Provenance); err != nil {
+				return nil, fmt.Errorf("stored provenance: %v", err)
+			}
+		}
+		if err := s.checkReleaseAge(&release{tag: groundTruth.Tag, digest: groundTruth.Digest, provenance: groundTruth.Provenance}); err != nil {
+			return nil, fmt.Errorf("stored release: %v", err)
+		}
+		if err := s.checkStoredRelease(groundTruth); err != nil {
+			return nil, err
+		}
+	}
+
+	return groundTruth, nil
+}
+
+// storeRepo returns the repo key the ground truth is stored under. A non-default verification policy qualifies it
+// with a fingerprint of the policy, so a ground truth is only restored by clients that verify the same way.
+// It returns false if the policy has no stable fingerprint, in which case the store is not used.
+func (s *SecureClient) storeRepo() (string, bool) {
+	fingerprint, ok := s.policyFingerprint()
+	if !ok {
+		return "", false
+	}
+	if fingerprint != "" {
+		return s.repo + "#" + fingerprint, true
+	}
+	return s.repo, true
+}
+
+// policyFingerprint returns a digest of the identity policy, trusted roots, GitHub and OCI sources and hardware provider,
+// or an empty string if they are all the defaults. It returns false if the hardware provider has no stable fingerprint.
+func (s *SecureClient) policyFingerprint() (string, bool) {
+	if s.identityPolicy == nil && len(s.trustRoots) == 0 && s.githubSource == nil && s.ociRepository == "" && s.hardwareProvider == nil {
+		return "", true
+	}
+
+	policy := struct {
+		Identity   *sigstore.IdentityPolicy `json:"identity,omitempty"`
+		TrustRoots []string                 `json:"trust_roots,omitempty"`
+		GitHub     []string                 `json:"github,omitempty"`
+		OCI        string                   `json:"oci,omitempty"`
+		Hardware   string                   `json:"hardware,omitempty"`
+	}{Identity: s.identityPolicy, OCI: s.ociRepository}
+	for _, opts := range s.trustRoots {
+		root, embedded := sha256.Sum256(opts.Root), sha256.Sum256(opts.Embedded)
+		policy.TrustRoots = append(policy.TrustRoots, opts.Mirror+" "+hex.EncodeToString(root[:])+" "+hex.EncodeToString(embedded[:]))
+	}
+	if s.githubSource != nil {
+		policy.GitHub = []string{s.githubSource.APIURL, s.githubSource.AttestationURL, s.githubSource.DownloadURL, s.githubSource.ServerURL}
+	}
+	if s.hardwareProvider != nil {
+		fingerprinter, ok := s.hardwareProvider.(sigstore.HardwareFingerprinter)
+		if !ok {
+			return "", false
+		}
+		if policy.Hardware, ok = fingerprinter.Fingerprint(); !ok {
+			return "", false
+		}
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), true
+}
+
+// checkStoredRelease checks that the stored release is still one the client would verify against.
+// A pinned tag or digest and a release policy are always checked, the latest release only if required.
+func (s *SecureClient) checkStoredRelease(groundTruth *GroundTruth) error {
+	if s.hasReleasePolicy() {
+		if s.lastReleases == 0 {
+			if !s.allowedReleases.IsValidVersion(groundTruth.Tag) {
+				return fmt.Errorf("stored release %q is not allowed", groundTruth.Tag)
+			}
+			return nil
+		}
+		tags, err := s.candidateTags()
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(tags, groundTruth.Tag) {
+			return fmt.Errorf("stored release %q is not allowed", groundTruth.Tag)
+		}
+		return nil
+	}
+
+	if !s.checkLatestDigest && s.releaseTag == "" && s.releaseDigest == "" {
+		return nil
+	}
+	_, digest, err := s.fetchRelease()
+	if err != nil {
+		return err
+	}
+	if digest != groundTruth.Digest {
+		return fmt.Errorf("stored digest %s does not match release digest %s", groundTruth.Digest, digest)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/config"
+	gh "github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+func testGroundTruth() *GroundTruth {
+	return &GroundTruth{
+		EnclaveHost:  "enclave.example.com",
+		TLSPublicKey: "tlskey",
+		Digest:       "abcdef",
+		CodeMeasurement: &attestation.Measurement{
+			Type:      attestation.SnpTdxMultiPlatformV1,
+			Registers: []string{"a", "b"},
+		},
+	}
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	_, err = store.Load("enclave.example.com", "org/repo")
+	assert.ErrorIs(t, err, ErrGroundTruthNotFound)
+
+	require.NoError(t, store.Save("enclave.example.com", "org/repo", testGroundTruth()))
+	loaded, err := store.Load("enclave.example.com", "org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, testGroundTruth(), loaded)
+
+	_, err = store.Load("enclave.example.com", "org/other")
+	assert.ErrorIs(t, err, ErrGroundTruthNotFound)
+}
+
+func TestFileStoreKeyPersisted(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Save("enclave.example.com", "org/repo", testGroundTruth()))
+
+	reopened, err := NewFileStore(dir, time.Hour)
+	require.NoError(t, err)
+	_, err = reopened.Load("enclave.example.com", "org/repo")
+	assert.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestFileStoreInvalidTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		_, err := NewFileStore(t.TempDir(), ttl)
+		assert.ErrorContains(t, err, "invalid store TTL")
+	}
+}
+
+func TestFileStoreExpiry(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Save("enclave.example.com", "org/repo", testGroundTruth()))
+	_, err = store.Load("enclave.example.com", "org/repo")
+	require.NoError(t, err)
+
+	// Backdate the entry past the TTL, keeping it authentic
+	path := store.path("enclave.example.com", "org/repo")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entry fileStoreEntry
+	require.NoError(t, json.Unmarshal(data, &entry))
+	entry.VerifiedAt = entry.VerifiedAt.Add(-2 * time.Hour)
+	entry.MAC = store.mac(&entry)
+	data, err = json.Marshal(&entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	_, err = store.Load("enclave.example.com", "org/repo")
+	assert.ErrorIs(t, err, ErrGroundTruthExpired)
+}
+
+func TestFileStoreTampered(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Save("enclave.example.com", "org/repo", testGroundTruth()))
+
+	path := store.path("enclave.example.com", "org/repo")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entry map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &entry))
+	entry["ground_truth"] = json.RawMessage(`{"enclave_host":"enclave.example.com","tls_public_key":"attacker"}`)
+	data, err = json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	_, err = store.Load("enclave.example.com", "org/repo")
+	assert.ErrorIs(t, err, ErrGroundTruthTampered)
+}
+
+func TestSecureClientRestoresGroundTruth(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	require.NoError(t, store.Save(pinned.Enclave(), pinned.Repo(), pinned.groundTruth))
+
+	var verifications atomic.Int32
+	client := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), withVerify(func(string) (*GroundTruth, error) {
+		verifications.Add(1)
+		return nil, errors.New("full verification not expected")
+	}))...)
+
+	resp, err := client.Get("/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(resp.Body))
+	assert.Equal(t, int32(0), verifications.Load())
+	assert.Equal(t, pinned.groundTruth, client.GroundTruth())
+}
+
+func TestSecureClientRestoreKeyMismatch(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	stale := *pinned.groundTruth
+	stale.TLSPublicKey = "rotated"
+	require.NoError(t, store.Save(pinned.Enclave(), pinned.Repo(), &stale))
+
+	var verifications atomic.Int32
+	client := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), withVerify(func(string) (*GroundTruth, error) {
+		verifications.Add(1)
+		return pinned.groundTruth, nil
+	}))...)
+
+	_, err = client.Get("/", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), verifications.Load())
+
+	// The full verification replaces the stale entry
+	stored, err := store.Load(pinned.Enclave(), pinned.Repo())
+	require.NoError(t, err)
+	assert.Equal(t, pinned.groundTruth, stored)
+}
+
+func TestSecureClientRestorePinnedDigest(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	stored := *pinned.groundTruth
+	stored.Digest = "olddigest"
+	require.NoError(t, store.Save(pinned.Enclave(), pinned.Repo(), &stored))
+
+	client := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithDigest("olddigest"))...)
+	_, err = client.restoreGroundTruth()
+	assert.NoError(t, err)
+
+	client = NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithDigest("newdigest"))...)
+	_, err = client.restoreGroundTruth()
+	assert.ErrorContains(t, err, "does not match release digest newdigest")
+}
+
+func TestSecureClientRestoreAllowedReleases(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	stored := *pinned.groundTruth
+	stored.Tag = "v1.4.2"
+	require.NoError(t, store.Save(pinned.Enclave(), pinned.Repo(), &stored))
+
+	allowed, err := config.New(">=1.4.0, <2")
+	require.NoError(t, err)
+	client := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithAllowedReleases(allowed))...)
+	restored, err := client.restoreGroundTruth()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.2", restored.Tag)
+
+	allowed, err = config.New(">=1.5.0")
+	require.NoError(t, err)
+	client = NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithAllowedReleases(allowed))...)
+	_, err = client.restoreGroundTruth()
+	assert.ErrorContains(t, err, `stored release "v1.4.2" is not allowed`)
+}
+
+func TestSecureClientRestoreIdentityPolicy(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	enclaves, pinned := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	stored := *pinned.groundTruth
+	stored.Provenance = &sigstore.Provenance{
+		SignerSAN:         "https://github.com/" + pinned.Repo() + "/.github/workflows/release.yml@refs/tags/v1.2.3",
+		Issuer:            "https://token.actions.githubusercontent.com",
+		RunnerEnvironment: "self-hosted",
+	}
+
+	policy := sigstore.IdentityPolicy{Workflow: ".github/workflows/release.yml"}
+	client := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithIdentityPolicy(policy))...)
+	require.NoError(t, store.Save(pinned.Enclave(), storeRepo(t, client), &stored))
+	restored, err := client.restoreGroundTruth()
+	require.NoError(t, err)
+	assert.Equal(t, stored.Provenance, restored.Provenance)
+
+	// Entries are stored per policy, so neither the default nor a stricter policy finds it
+	plain := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store))...)
+	_, err = plain.restoreGroundTruth()
+	assert.ErrorIs(t, err, ErrGroundTruthNotFound)
+
+	policy.RunnerEnvironment = "github-hosted"
+	strict := NewSecureClient(pinned.Enclave(), pinned.Repo(), enclaves.options(WithGroundTruthStore(store), WithIdentityPolicy(policy))...)
+	_, err = strict.restoreGroundTruth()
+	assert.ErrorIs(t, err, ErrGroundTruthNotFound)
+
+	// The stricter policy also rejects the provenance if a store hands out the entry regardless
+	require.NoError(t, store.Save(pinned.Enclave(), storeRepo(t, strict), &stored))
+	_, err = strict.restoreGroundTruth()
+	assert.ErrorContains(t, err, "runner environment")
+}
+
+// storeRepo returns the key the client stores its ground truth under
+func storeRepo(t *testing.T, client *SecureClient) string {
+	repo, ok := client.storeRepo()
+	require.True(t, ok)
+	return repo
+}
+
+// opaqueHardware is a custom provider without a fingerprint
+type opaqueHardware struct{}
+
+func (*opaqueHardware) HardwareMeasurements(*sigstore.Client) ([]*attestation.HardwareMeasurement, error) {
+	return nil, nil
+}
+
+func TestSecureClientPolicyFingerprint(t *testing.T) {
+	repo := "tinfoilsh/test"
+	assert.Equal(t, repo, storeRepo(t, NewSecureClient("enclave.example.com", repo)))
+
+	hardware := func(tag string) Option {
+		return WithHardwareProvider(sigstore.NewCachedHardware(sigstore.HardwareRepo{Repo: "org/hardware", Tag: tag}, time.Hour))
+	}
+	keys := map[string]bool{}
+	for _, opt := range []Option{
+		WithIdentityPolicy(sigstore.IdentityPolicy{}),
+		WithIdentityPolicy(sigstore.IdentityPolicy{Workflow: ".github/workflows/release.yml"}),
+		WithTrustRoots(sigstore.TrustRootOptions{Mirror: "https://tuf.example.com", Root: []byte("root")}),
+		WithGitHubSource(&gh.Source{APIURL: "https://github.example.com/api/v3"}),
+		WithOCISource("ghcr.io/org/image"),
+		hardware("v1"),
+		hardware("v2"),
+		WithHardwareProvider(sigstore.MergedHardware{sigstore.HardwareFile("hardware.json"), sigstore.HardwareRepo{Repo: "org/hardware"}}),
+	} {
+		key := storeRepo(t, NewSecureClient("enclave.example.com", repo, opt))
+		assert.Equal(t, key, storeRepo(t, NewSecureClient("enclave.example.com", repo, opt)))
+		assert.NotEqual(t, repo, key)
+		keys[key] = true
+	}
+	assert.Len(t, keys, 8)
+
+	// Providers are fingerprinted by what they fetch, not by their address in this process
+	assert.Equal(t, storeRepo(t, NewSecureClient("enclave.example.com", repo, hardware("v1"))),
+		storeRepo(t, NewSecureClient("enclave.example.com", repo, hardware("v1"))))
+
+	// A provider without a fingerprint disables the store rather than sharing a key
+	for _, provider := range []sigstore.HardwareProvider{
+		&opaqueHardware{},
+		sigstore.MergedHardware{sigstore.HardwareFile("hardware.json"), &opaqueHardware{}},
+		sigstore.NewCachedHardware(&opaqueHardware{}, time.Hour),
+	} {
+		_, ok := NewSecureClient("enclave.example.com", repo, WithHardwareProvider(provider)).storeRepo()
+		assert.False(t, ok)
+	}
+}
+
+func TestSecureClientStoreSkippedWithoutFingerprint(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), time.Hour)
+	require.NoError(t, err)
+
+	client := NewSecureClient("enclave.example.com", "tinfoilsh/test", WithGroundTruthStore(store), WithHardwareProvider(&opaqueHardware{}),
+		withVerify(func(enclave string) (*GroundTruth, error) {
+			return &GroundTruth{EnclaveHost: enclave}, nil
+		}))
+	_, err = client.Verify()
+	require.NoError(t, err)
+
+	entries, err := filepath.Glob(filepath.Join(store.dir, "*.json"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = client.restoreGroundTruth()
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Event represents a single server-sent event
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry int
+}
+
+// EventStream reads server-sent events incrementally from a streaming response
+type EventStream struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+// NewEventStream creates an event stream over a response body. The stream takes ownership of the body.
+func NewEventStream(resp *http.Response) *EventStream {
+	return &EventStream{
+		resp:   resp,
+		reader: bufio.NewReader(resp.Body),
+	}
+}
+
+// Response returns the underlying HTTP response
+func (e *EventStream) Response() *http.Response {
+	return e.resp
+}
+
+// Next blocks until the next event is received. It returns io.EOF once the stream has ended.
+func (e *EventStream) Next() (*Event, error) {
+	var event Event
+	var data strings.Builder
+	var hasData bool
+
+	for {
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			// An event that is not terminated by a blank line is discarded
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if !hasData {
+				// Ignore empty events and comment-only blocks
+				event = Event{}
+				continue
+			}
+			event.Data = strings.TrimSuffix(data.String(), "\n")
+			return &event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				event.ID = value
+			}
+		case "retry":
+			if retry, err := strconv.Atoi(value); err == nil && retry >= 0 {
+				event.Retry = retry
+			}
+		}
+	}
+}
+
+// Close closes the underlying response body
+func (e *EventStream) Close() error {
+	return e.resp.Body.Close()
+}
+
+// Stream sends a request to the enclave and returns the response as a stream of server-sent events
+func (s *SecureClient) Stream(req *http.Request) (*EventStream, error) {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("stream: unexpected status %s: %s", resp.Status, string(body))
+	}
+
+	return NewEventStream(resp), nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStreamParse(t *testing.T) {
+	body := ": keepalive\n" +
+		"data: first\n\n" +
+		"event: update\r\nid: 7\r\nretry: 1500\r\ndata: line one\r\ndata:line two\r\n\r\n" +
+		"id: 8\n\n" +
+		"data: [DONE]\n\n" +
+		"data: unterminated"
+
+	stream := NewEventStream(&http.Response{Body: io.NopCloser(strings.NewReader(body))})
+
+	event, err := stream.Next()
+	require.NoError(t, err)
+	assert.Equal(t, &Event{Data: "first"}, event)
+
+	event, err = stream.Next()
+	require.NoError(t, err)
+	assert.Equal(t, &Event{ID: "7", Event: "update", Data: "line one\nline two", Retry: 1500}, event)
+
+	event, err = stream.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "[DONE]", event.Data)
+
+	_, err = stream.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestSecureClientStream(t *testing.T) {
+	release := make(chan struct{})
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: chunk %d\n\n", i)
+			w.(http.Flusher).Flush()
+			// Hold the stream open until the client has seen the event
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"stream":true}`))
+	require.NoError(t, err)
+
+	stream, err := client.Stream(req)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	for i := 0; i < 3; i++ {
+		event, err := stream.Next()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("chunk %d", i), event.Data)
+		release <- struct{}{}
+	}
+
+	_, err = stream.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestSecureClientStreamStatus(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/events", nil)
+	require.NoError(t, err)
+
+	_, err = client.Stream(req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+}
+
+func TestSecureClientDoPinning(t *testing.T) {
+	_, client := newTestEnclave(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+
+	// A different pinned key must reject the connection
+	client.groundTruth = &GroundTruth{TLSPublicKey: "deadbeef"}
+	req, err = http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, ErrCertMismatch)
+}
@@ -0,0 +1,432 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/oci"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+// verify runs the full verification pipeline against the enclave.
+// Code provenance, enclave attestation and hardware measurements are independent of each other and run concurrently.
+// The attestation is fetched over the TLS connection whose key it covers, and that connection is kept for the first HTTP request.
+func (s *SecureClient) verify() (*GroundTruth, error) {
+	enclave := s.Enclave()
+
+	var wg sync.WaitGroup
+
+	// With a release policy the matching release depends on the enclave's measurement,
+	// so only the candidate tags are resolved up front
+	candidates := s.codeMeasurement == nil && s.hasReleasePolicy()
+	var code = &release{digest: pinnedNoDigest, measurement: s.codeMeasurement}
+	var candidateTags []string
+	var codeErr error
+	if s.codeMeasurement == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch {
+			case candidates:
+				candidateTags, codeErr = s.candidateTags()
+			case s.code != nil:
+				code, codeErr = s.code.get(s.verifyCode)
+			default:
+				code, codeErr = s.verifyCode()
+			}
+		}()
+	}
+
+	var enclaveConn net.Conn
+	var enclaveVerification *attestation.Verification
+	var enclaveErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// With EHBP or response signatures, responses are bound to an attested key, so the TLS connection may terminate outside the enclave
+		if !s.pinsTLS() {
+			_, enclaveVerification, enclaveErr = verifyEnclave(enclave)
+		} else {
+			enclaveConn, _, enclaveVerification, enclaveErr = s.attestEnclave(enclave)
+		}
+	}()
+
+	// Hardware measurements are only needed for TDX enclaves. They are fetched before the platform is known
+	// to keep them off the critical path, but only waited for once the enclave turns out to be TDX.
+	type hwResult struct {
+		measurements []*attestation.HardwareMeasurement
+		err          error
+	}
+	var hwFetched chan hwResult
+	if len(s.hardwareMeasurements) == 0 {
+		hwFetched = make(chan hwResult, 1)
+		go func() {
+			measurements, err := s.fetchHardwareMeasurements()
+			hwFetched <- hwResult{measurements, err}
+		}()
+	}
+
+	wg.Wait()
+
+	if codeErr != nil {
+		if enclaveConn != nil {
+			enclaveConn.Close()
+		}
+		return nil, codeErr
+	}
+	if enclaveErr != nil {
+		return nil, enclaveErr
+	}
+
+	var hwMeasurements = s.hardwareMeasurements
+	var hwErr error
+	if hwFetched != nil && enclaveVerification.Measurement.Type == attestation.TdxGuestV2 {
+		hw := <-hwFetched
+		hwMeasurements, hwErr = hw.measurements, hw.err
+	}
+
+	if candidates {
+		var err error
+		code, err = s.matchRelease(candidateTags, enclaveVerification.Measurement)
+		if err != nil {
+			if enclaveConn != nil {
+				enclaveConn.Close()
+			}
+			return nil, err
+		}
+		// Backends behind the hostname are matched against the same candidates
+		s.mu.Lock()
+		s.candidates = candidateTags
+		s.mu.Unlock()
+	} else if err := s.checkReleaseAge(code); err != nil {
+		if enclaveConn != nil {
+			enclaveConn.Close()
+		}
+		return nil, fmt.Errorf("verifyCode: %v", err)
+	}
+
+	groundTruth, err := enclaveGroundTruth(enclave, code, enclaveVerification, hwMeasurements, hwErr)
+	if err != nil {
+		if enclaveConn != nil {
+			enclaveConn.Close()
+		}
+		return nil, err
+	}
+	if s.signedResponses && !s.ehbp && groundTruth.SigningPublicKey == "" {
+		return nil, fmt.Errorf("validateSignatures: %v", ErrNoSigningKey)
+	}
+	if enclaveConn != nil {
+		s.keepAttestedConn(enclaveConn, enclaveAddr(enclave))
+	}
+	return groundTruth, nil
+}
+
+// enclaveGroundTruth checks a verified enclave attestation against the code measurement and, for TDX enclaves,
+// the hardware platform measurements, and returns the resulting ground truth
+func enclaveGroundTruth(enclave string, code *release, enclaveVerification *attestation.Verification, hwMeasurements []*attestation.HardwareMeasurement, hwErr error) (*GroundTruth, error) {
+	// Match hardware platform measurements if required
+	var matchedHwMeasurement *attestation.HardwareMeasurement
+	if enclaveVerification.Measurement.Type == attestation.TdxGuestV2 {
+		if hwErr != nil {
+			return nil, hwErr
+		}
+
+		var err error
+		matchedHwMeasurement, err = attestation.VerifyHardware(hwMeasurements, enclaveVerification.Measurement)
+		if err != nil {
+			return nil, fmt.Errorf("verifyHardware: failed to verify hardware measurements: %v", err)
+		}
+	}
+
+	codeMeasurement := code.measurement
+	if err := codeMeasurement.Equals(enclaveVerification.Measurement); err != nil {
+		return nil, fmt.Errorf("measurements: %v", err)
+	}
+
+	codeFingerprint, err := attestation.Fingerprint(codeMeasurement, matchedHwMeasurement, enclaveVerification.Measurement.Type)
+	if err != nil {
+		return nil, fmt.Errorf("measurements: failed to compute code fingerprint: %v", err)
+	}
+	enclaveFingerprint, err := attestation.Fingerprint(enclaveVerification.Measurement, matchedHwMeasurement, enclaveVerification.Measurement.Type)
+	if err != nil {
+		return nil, fmt.Errorf("measurements: failed to compute enclave fingerprint: %v", err)
+	}
+
+	return &GroundTruth{
+		EnclaveHost:         enclave,
+		TLSPublicKey:        enclaveVerification.TLSPublicKeyFP,
+		HPKEPublicKey:       enclaveVerification.HPKEPublicKey,
+		SigningPublicKey:    enclaveVerification.SigningPublicKey,
+		Tag:                 code.tag,
+		Digest:              code.digest,
+		Provenance:          code.provenance,
+		HardwareMeasurement: matchedHwMeasurement,
+		CodeMeasurement:     codeMeasurement,
+		EnclaveMeasurement:  enclaveVerification.Measurement,
+		CodeFingerprint:     codeFingerprint,
+		EnclaveFingerprint:  enclaveFingerprint,
+	}, nil
+}
+
+// github returns the source releases and attestations are fetched from
+func (s *SecureClient) github() *github.Source {
+	if s.githubSource != nil {
+		return s.githubSource
+	}
+	return github.DefaultSource
+}
+
+// fetchAttestationBundles fetches the attestation bundles of the digest from the OCI source, if any, or the GitHub source
+func (s *SecureClient) fetchAttestationBundles(digest string) ([][]byte, error) {
+	if s.ociRepository != "" {
+		return oci.FetchAttestationBundles(s.ociRepository, digest, s.ociOptions...)
+	}
+	return s.github().FetchAttestationBundles(s.repo, digest)
+}
+
+// release is a release of the repo whose code measurement has been verified with sigstore
+type release struct {
+	tag, digest string
+	measurement *attestation.Measurement
+	provenance  *sigstore.Provenance
+}
+
+// fetchRelease returns the tag and digest of the release to verify: the pinned digest, the pinned tag, or the latest release.
+// The tag of a pinned digest is the pinned tag, if any, so that the digest's attestation is checked against it.
+func (s *SecureClient) fetchRelease() (string, string, error) {
+	if s.releaseDigest != "" {
+		return s.releaseTag, s.releaseDigest, nil
+	}
+
+	tag := s.releaseTag
+	if tag == "" {
+		var err error
+		tag, err = s.github().FetchLatestTag(s.repo)
+		if err != nil {
+			return "", "", fmt.Errorf("fetchDigest: failed to fetch latest release: %v", err)
+		}
+	}
+	digest, err := s.github().FetchDigest(s.repo, tag)
+	if err != nil {
+		return "", "", fmt.Errorf("fetchDigest: failed to fetch digest for %s@%s: %v", s.repo, tag, err)
+	}
+	return tag, digest, nil
+}
+
+// verifyCode fetches the release to verify and verifies its attested code measurement.
+// The sigstore trust root is loaded while the release is being fetched.
+func (s *SecureClient) verifyCode() (*release, error) {
+	var sigstoreClient *sigstore.Client
+	var sigstoreErr error
+	sigstoreReady := make(chan struct{})
+	go func() {
+		defer close(sigstoreReady)
+		sigstoreClient, sigstoreErr = s.getSigstoreClient()
+	}()
+
+	tag, digest, err := s.fetchRelease()
+	if err != nil {
+		return nil, err
+	}
+
+	sigstoreBundles, err := s.fetchAttestationBundles(digest)
+	if err != nil {
+		return nil, fmt.Errorf("verifyCode: failed to fetch attestation bundles: %v", err)
+	}
+
+	<-sigstoreReady
+	if sigstoreErr != nil {
+		return nil, fmt.Errorf("verifyCode: failed to create sigstore client: %v", sigstoreErr)
+	}
+
+	verified, err := verifyAttestations(sigstoreClient, sigstoreBundles, s.repo, tag, digest)
+	if err != nil {
+		return nil, fmt.Errorf("verifyCode: failed to verify attested measurements: %v", err)
+	}
+	return &release{tag: tag, digest: digest, measurement: verified.Measurement, provenance: verified.Provenance}, nil
+}
+
+// verifyAttestations verifies the attestation bundles of a digest. If the digest was fetched for a release tag,
+// the attestation must have been built from that tag, so a digest of another release is rejected.
+// The latest tag and the candidate tags come from the proxy, so only a pinned tag or digest, a version floor or a
+// maximum release age rules out older releases.
+func verifyAttestations(sigstoreClient *sigstore.Client, bundles [][]byte, repo, tag, digest string) (*sigstore.VerifiedAttestation, error) {
+	var verified *sigstore.VerifiedAttestation
+	var err error
+	if tag == "" {
+		verified, _, err = sigstoreClient.VerifyAttestations(bundles, repo, digest)
+	} else {
+		verified, _, err = sigstoreClient.VerifyReleaseAttestations(bundles, repo, tag, digest)
+	}
+	return verified, err
+}
+
+// hasReleasePolicy reports whether the enclave may run any of several releases rather than a single one
+func (s *SecureClient) hasReleasePolicy() bool {
+	return (s.allowedReleases != nil || s.lastReleases > 0) && s.releaseTag == "" && s.releaseDigest == ""
+}
+
+// candidateTags returns the release tags allowed by the release policy, newest first
+func (s *SecureClient) candidateTags() ([]string, error) {
+	tags, err := s.github().FetchReleaseTags(s.repo)
+	if err != nil {
+		return nil, fmt.Errorf("fetchDigest: failed to fetch releases: %v", err)
+	}
+	if s.lastReleases > 0 && len(tags) > s.lastReleases {
+		tags = tags[:s.lastReleases]
+	}
+	if s.allowedReleases == nil {
+		return tags, nil
+	}
+
+	var allowed []string
+	for _, tag := range tags {
+		if s.allowedReleases.IsValidVersion(tag) {
+			allowed = append(allowed, tag)
+		}
+	}
+	return allowed, nil
+}
+
+// maxConcurrentReleases bounds how many candidate releases are verified at once
+const maxConcurrentReleases = 4
+
+// matchRelease verifies the candidate releases concurrently and returns the newest whose code measurement matches the enclave.
+// Verified releases are cached by tag, so later backends and clients sharing the cache only compare measurements.
+func (s *SecureClient) matchRelease(tags []string, enclaveMeasurement *attestation.Measurement) (*release, error) {
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("fetchDigest: no releases of %s satisfy the release policy", s.repo)
+	}
+
+	sigstoreClient, err := s.getSigstoreClient()
+	if err != nil {
+		return nil, fmt.Errorf("verifyCode: failed to create sigstore client: %v", err)
+	}
+
+	verifyTag := s.verifyTag
+	if s.verifyTagFunc != nil {
+		verifyTag = s.verifyTagFunc
+	}
+
+	releases := make([]*release, len(tags))
+	errs := make([]error, len(tags))
+	limit := make(chan struct{}, maxConcurrentReleases)
+	var wg sync.WaitGroup
+	for i, tag := range tags {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			releases[i], errs[i] = s.releases.get(tag, func() (*release, error) {
+				return verifyTag(sigstoreClient, tag)
+			})
+		}()
+	}
+	wg.Wait()
+
+	var mismatches []error
+	for i, tag := range tags {
+		if errs[i] != nil {
+			mismatches = append(mismatches, fmt.Errorf("%s: %v", tag, errs[i]))
+			continue
+		}
+		if err := releases[i].measurement.Equals(enclaveMeasurement); err != nil {
+			mismatches = append(mismatches, fmt.Errorf("%s: %v", tag, err))
+			continue
+		}
+		if err := s.checkReleaseAge(releases[i]); err != nil {
+			mismatches = append(mismatches, fmt.Errorf("%s: %v", tag, err))
+			continue
+		}
+		return releases[i], nil
+	}
+	return nil, fmt.Errorf("measurements: no allowed release matches the enclave: %v", errors.Join(mismatches...))
+}
+
+// verifyTag fetches the release with the tag and verifies its attested code measurement
+func (s *SecureClient) verifyTag(sigstoreClient *sigstore.Client, tag string) (*release, error) {
+	digest, err := s.github().FetchDigest(s.repo, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch digest: %v", err)
+	}
+	sigstoreBundles, err := s.fetchAttestationBundles(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attestation bundles: %v", err)
+	}
+	verified, err := verifyAttestations(sigstoreClient, sigstoreBundles, s.repo, tag, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify attested measurements: %v", err)
+	}
+	return &release{tag: tag, digest: digest, measurement: verified.Measurement, provenance: verified.Provenance}, nil
+}
+
+// checkReleaseAge rejects a release whose attestation was logged longer than the maximum release age ago.
+// Verified releases are cached, so the age is checked each time a release is used rather than when it is verified.
+func (s *SecureClient) checkReleaseAge(code *release) error {
+	if s.maxReleaseAge <= 0 || s.codeMeasurement != nil {
+		return nil
+	}
+	name := code.tag
+	if name == "" {
+		name = code.digest
+	}
+	attestedAt := releaseTime(code.provenance)
+	if attestedAt.IsZero() {
+		return fmt.Errorf("release %s has no transparency log or timestamp time", name)
+	}
+	if time.Since(attestedAt) > s.maxReleaseAge {
+		return fmt.Errorf("release %s was attested at %s, more than %v ago", name, attestedAt.UTC().Format(time.RFC3339), s.maxReleaseAge)
+	}
+	return nil
+}
+
+// releaseTime returns the latest time a verified attestation was logged or timestamped at, or the zero time if unknown
+func releaseTime(provenance *sigstore.Provenance) time.Time {
+	if provenance == nil {
+		return time.Time{}
+	}
+	attestedAt := provenance.IntegratedTime
+	for _, ts := range provenance.SignedTimestamps {
+		if ts.After(attestedAt) {
+			attestedAt = ts
+		}
+	}
+	return attestedAt
+}
+
+// verifyEnclave fetches and verifies the enclave's runtime attestation
+func verifyEnclave(enclave string) (*attestation.Document, *attestation.Verification, error) {
+	enclaveAttestation, err := attestation.Fetch(enclave)
+	if err != nil {
+		return nil, nil, fmt.Errorf("verifyEnclave: failed to fetch enclave measurements: %v", err)
+	}
+	enclaveVerification, err := enclaveAttestation.Verify()
+	if err != nil {
+		return nil, nil, fmt.Errorf("verifyEnclave: failed to verify enclave measurements: %v", err)
+	}
+	return enclaveAttestation, enclaveVerification, nil
+}
+
+// fetchHardwareMeasurements fetches the TDX platform measurements from the configured provider, by default the latest release of the default repo
+func (s *SecureClient) fetchHardwareMeasurements() ([]*attestation.HardwareMeasurement, error) {
+	sigstoreClient, err := s.getSigstoreClient()
+	if err != nil {
+		return nil, fmt.Errorf("verifyHardware: failed to create sigstore client: %v", err)
+	}
+	var hwMeasurements []*attestation.HardwareMeasurement
+	if hardware := s.sharedSigstore().hardware; hardware != nil {
+		hwMeasurements, err = hardware.HardwareMeasurements(sigstoreClient)
+	} else {
+		hwMeasurements, err = sigstoreClient.LatestHardwareMeasurements()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("verifyHardware: failed to fetch TDX platform measurements: %v", err)
+	}
+	return hwMeasurements, nil
+}
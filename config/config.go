@@ -17,14 +17,19 @@ func Parse(s string) (*Config, error) {
 	if err := json.Unmarshal([]byte(s), &c); err != nil {
 		return nil, err
 	}
+	return New(c.Allowed)
+}
 
-	var err error
-	c.constraints, err = semver.NewConstraint(c.Allowed)
+// New creates a config that allows the versions matching a semver constraint such as ">= 1.4.0, < 2"
+func New(allowed string) (*Config, error) {
+	constraints, err := semver.NewConstraint(allowed)
 	if err != nil {
 		return nil, err
 	}
-
-	return &c, nil
+	return &Config{
+		Allowed:     allowed,
+		constraints: constraints,
+	}, nil
 }
 
 // IsValidVersion checks if the given version is allowed by the config
@@ -20,3 +20,16 @@ func TestConfigParse(t *testing.T) {
 	assert.False(t, conf.IsValidVersion("1.2.2"))
 	assert.False(t, conf.IsValidVersion("1.1.3"))
 }
+
+func TestConfigNew(t *testing.T) {
+	conf, err := New(">=1.4.0, <2")
+	assert.Nil(t, err)
+
+	assert.True(t, conf.IsValidVersion("v1.4.0"))
+	assert.True(t, conf.IsValidVersion("1.9.2"))
+	assert.False(t, conf.IsValidVersion("v2.0.0"))
+	assert.False(t, conf.IsValidVersion("not-a-version"))
+
+	_, err = New("not a constraint")
+	assert.Error(t, err)
+}
@@ -50,22 +50,31 @@ func main() {
 
 		if *repo != "" {
 			log.With("repo", *repo).Info("Fetching latest release")
-			digest, err := github.FetchLatestDigest(*repo)
+			tag, err := github.FetchLatestTag(*repo)
 			if err != nil {
 				log.Fatalf("failed to fetch latest release: %v", err)
 			}
+			digest, err := github.FetchDigest(*repo, tag)
+			if err != nil {
+				log.Fatalf("failed to fetch digest for %s: %v", tag, err)
+			}
 
-			log.With("repo", *repo, "digest", digest).Info("Fetching attestation bundle")
-			sigstoreBundle, err := github.FetchAttestationBundle(*repo, digest)
+			log.With("repo", *repo, "tag", tag, "digest", digest).Info("Fetching attestation bundles")
+			sigstoreBundles, err := github.FetchAttestationBundles(*repo, digest)
 			if err != nil {
-				log.Fatalf("failed to fetch attestation bundle: %v", err)
+				log.Fatalf("failed to fetch attestation bundles: %v", err)
 			}
 
 			log.Info("Verifying source attestation")
-			codeMeasurements, err = sigstoreClient.VerifyAttestation(sigstoreBundle, *repo, digest)
+			verified, skipped, err := sigstoreClient.VerifyReleaseAttestations(sigstoreBundles, *repo, tag, digest)
+			for _, s := range skipped {
+				log.Infof("Skipped %s", s)
+			}
 			if err != nil {
 				log.Fatalf("failed to verify attested measurements: %v", err)
 			}
+			codeMeasurements = verified.Measurement
+			log.With("log_index", verified.Provenance.LogIndex, "signer", verified.Provenance.SignerSAN).Info("Verified source attestation")
 		}
 	}()
 
@@ -106,7 +115,7 @@ func main() {
 
 	log.With("runtime", verification.Measurement, "source", codeMeasurements).Info("Measurements")
 
-	if enclaveAttestation.Format == attestation.TdxGuestV2 {
+	if verification.Measurement.Type == attestation.TdxGuestV2 {
 		log.Info("Fetching latest hardware measurements")
 		hwMeasurements, err := sigstoreClient.LatestHardwareMeasurements()
 		if err != nil {
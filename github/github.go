@@ -1,77 +1,54 @@
 package github
 
-import (
-	"encoding/json"
-	"fmt"
-	"strings"
+// FetchLatestTag fetches the latest tag for a repo from the default source
+func FetchLatestTag(repo string) (string, error) {
+	return DefaultSource.FetchLatestTag(repo)
+}
 
-	"github.com/tinfoilsh/verifier/util"
-)
+// FetchReleaseTags fetches the tags of a repo's published releases from the default source, newest first.
+// Drafts and prereleases are skipped.
+func FetchReleaseTags(repo string) ([]string, error) {
+	return DefaultSource.FetchReleaseTags(repo)
+}
 
-// FetchLatestTag fetches the latest tag for a repo
-func FetchLatestTag(repo string) (string, error) {
-	url := "https://api-github-proxy.tinfoil.sh/repos/" + repo + "/releases/latest"
-	releaseResponse, _, err := util.Get(url)
-	if err != nil {
-		return "", err
-	}
+// ListReleases fetches a repo's releases from the default source, newest first, without their digests
+func ListReleases(repo string) ([]*Release, error) {
+	return DefaultSource.ListReleases(repo)
+}
 
-	var responseJSON struct {
-		TagName string `json:"tag_name"`
-		Body    string `json:"body"`
-	}
-	if err := json.Unmarshal(releaseResponse, &responseJSON); err != nil {
-		return "", err
-	}
+// FetchRelease fetches the release of a repo with the tag from the default source, including its digest
+func FetchRelease(repo, tag string) (*Release, error) {
+	return DefaultSource.FetchRelease(repo, tag)
+}
 
-	return responseJSON.TagName, nil
+// FetchLatestRelease fetches a repo's latest release from the default source, including its digest
+func FetchLatestRelease(repo string) (*Release, error) {
+	return DefaultSource.FetchLatestRelease(repo)
 }
 
-// FetchDigest fetches the attestation digest for a given repo and tag
+// FetchDigest fetches the attestation digest for a given repo and tag from the default source
 func FetchDigest(repo, tag string) (string, error) {
-	url := fmt.Sprintf(`https://api-github-proxy.tinfoil.sh/%s/releases/download/%s/tinfoil.hash`, repo, tag)
-	digest, _, err := util.Get(url)
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(string(digest)), nil
+	return DefaultSource.FetchDigest(repo, tag)
 }
 
-// FetchLatestDigest gets the latest release, tag, and attestation digest of a repo
+// FetchLatestDigest gets the latest release, tag, and attestation digest of a repo from the default source
 func FetchLatestDigest(repo string) (string, error) {
-	latestTag, err := FetchLatestTag(repo)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch latest tag: %v", err)
-	}
-	digest, err := FetchDigest(repo, latestTag)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch digest for %s@%s: %v", repo, latestTag, err)
-	}
-	return digest, nil
+	return DefaultSource.FetchLatestDigest(repo)
 }
 
-// FetchAttestationBundle fetches the sigstore bundle from a repo for a given repo and EIF hash
+// FetchAttestationBundle fetches the first sigstore bundle attested for the EIF hash in a repo.
+//
+// Deprecated: A digest may have several attestations, such as provenance and an SBOM besides the measurements;
+// use FetchAttestationBundles instead.
 func FetchAttestationBundle(repo, digest string) ([]byte, error) {
-	url := "https://gh-attestation-proxy.tinfoil.sh/repos/" + repo + "/attestations/sha256:" + digest
-	bundleResponse, _, err := util.Get(url)
+	bundles, err := FetchAttestationBundles(repo, digest)
 	if err != nil {
 		return nil, err
 	}
+	return bundles[0], nil
+}
 
-	var responseJSON struct {
-		Attestations []struct {
-			Bundle json.RawMessage `json:"bundle"`
-		} `json:"attestations"`
-	}
-
-	if err := json.Unmarshal(bundleResponse, &responseJSON); err != nil {
-		return nil, err
-	}
-
-	if len(responseJSON.Attestations) == 0 {
-		return nil, fmt.Errorf("no attestations found for digest %s", digest)
-	}
-
-	return responseJSON.Attestations[0].Bundle, nil
+// FetchAttestationBundles fetches every sigstore bundle attested for the EIF hash in a repo from the default source
+func FetchAttestationBundles(repo, digest string) ([][]byte, error) {
+	return DefaultSource.FetchAttestationBundles(repo, digest)
 }
@@ -30,3 +30,25 @@ func TestFetchAttestationBundle(t *testing.T) {
 	assert.NoError(t, err, "Failed to fetch attestation bundle for %s with digest %s", repo, digest)
 	assert.NotEmpty(t, bundle)
 }
+
+func TestFetchReleaseTags(t *testing.T) {
+	repo := "tinfoilsh/confidential-llama3-3-70b"
+
+	tags, err := FetchReleaseTags(repo)
+	assert.NoError(t, err, "Failed to fetch release tags for %s", repo)
+	assert.Contains(t, tags, "v0.0.1")
+}
+
+func TestFetchAttestationBundles(t *testing.T) {
+	repo := "tinfoilsh/confidential-llama3-3-70b"
+
+	digest, err := FetchDigest(repo, "v0.0.1")
+	assert.NoError(t, err)
+
+	bundles, err := FetchAttestationBundles(repo, digest)
+	assert.NoError(t, err, "Failed to fetch attestation bundles for %s with digest %s", repo, digest)
+	assert.NotEmpty(t, bundles)
+	for _, bundle := range bundles {
+		assert.NotEmpty(t, bundle)
+	}
+}
@@ -0,0 +1,149 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// DigestAsset is the release asset holding the hex attestation digest of the enclave image
+const DigestAsset = "tinfoil.hash"
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// URL is the REST API URL of the asset, which serves its content with Accept: application/octet-stream
+	URL string `json:"url"`
+	// DownloadURL is the browser download URL of the asset
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// Release is a GitHub release of an enclave repo
+type Release struct {
+	Tag         string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	PublishedAt time.Time `json:"published_at"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	// Notes is the markdown body of the release
+	Notes  string  `json:"body"`
+	Assets []Asset `json:"assets"`
+	// Digest is the content of the release's tinfoil.hash asset. It is only set by FetchRelease and FetchLatestRelease.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Asset returns the release asset with the name, or nil if there is none
+func (r *Release) Asset(name string) *Asset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// ListReleases fetches a repo's releases, newest first, without their digests.
+// Drafts are only listed for tokens with push access; prereleases are included.
+func (s *Source) ListReleases(repo string) ([]*Release, error) {
+	var releases []*Release
+	err := s.getPages(s.apiURL()+"/repos/"+repo+"/releases?per_page=100", func(page []byte) error {
+		var pageReleases []*Release
+		if err := json.Unmarshal(page, &pageReleases); err != nil {
+			return err
+		}
+		releases = append(releases, pageReleases...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// FetchRelease fetches the release of a repo with the tag, including its digest
+func (s *Source) FetchRelease(repo, tag string) (*Release, error) {
+	return s.fetchRelease(repo, s.apiURL()+"/repos/"+repo+"/releases/tags/"+neturl.PathEscape(tag))
+}
+
+// FetchLatestRelease fetches a repo's latest release, including its digest
+func (s *Source) FetchLatestRelease(repo string) (*Release, error) {
+	return s.fetchRelease(repo, s.apiURL()+"/repos/"+repo+"/releases/latest")
+}
+
+func (s *Source) fetchRelease(repo, url string) (*Release, error) {
+	var release Release
+	if err := s.getJSON(url, &release); err != nil {
+		return nil, err
+	}
+	digest, err := s.releaseDigest(repo, &release)
+	if err != nil {
+		return nil, err
+	}
+	release.Digest = digest
+	return &release, nil
+}
+
+// FetchLatestTag fetches the tag of a repo's latest release
+func (s *Source) FetchLatestTag(repo string) (string, error) {
+	var release Release
+	if err := s.getJSON(s.apiURL()+"/repos/"+repo+"/releases/latest", &release); err != nil {
+		return "", err
+	}
+	return release.Tag, nil
+}
+
+// FetchReleaseTags fetches the tags of a repo's published releases, newest first. Drafts and prereleases are skipped.
+func (s *Source) FetchReleaseTags(repo string) ([]string, error) {
+	releases, err := s.ListReleases(repo)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, release := range releases {
+		if release.Draft || release.Prerelease {
+			continue
+		}
+		tags = append(tags, release.Tag)
+	}
+	return tags, nil
+}
+
+// FetchDigest fetches the attestation digest published with a release
+func (s *Source) FetchDigest(repo, tag string) (string, error) {
+	if s.DownloadURL != "" {
+		return s.downloadDigest(repo, tag)
+	}
+	release, err := s.FetchRelease(repo, tag)
+	if err != nil {
+		return "", err
+	}
+	return release.Digest, nil
+}
+
+// releaseDigest fetches the content of the release's digest asset
+func (s *Source) releaseDigest(repo string, release *Release) (string, error) {
+	if s.DownloadURL != "" {
+		return s.downloadDigest(repo, release.Tag)
+	}
+	asset := release.Asset(DigestAsset)
+	if asset == nil {
+		return "", fmt.Errorf("release %s@%s has no %s asset: %w", repo, release.Tag, DigestAsset, ErrNotFound)
+	}
+	digest, _, err := s.get(asset.URL, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(digest)), nil
+}
+
+// downloadDigest downloads the digest asset of a release by path from DownloadURL
+func (s *Source) downloadDigest(repo, tag string) (string, error) {
+	digest, _, err := s.get(fmt.Sprintf("%s/%s/releases/download/%s/%s", strings.TrimSuffix(s.DownloadURL, "/"), repo, tag, DigestAsset), "")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(digest)), nil
+}
@@ -0,0 +1,51 @@
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListReleases(t *testing.T) {
+	server := newTestAPI(t)
+	src := NewEnterpriseSource(server.URL, testToken)
+
+	releases, err := src.ListReleases("org/repo")
+	require.NoError(t, err)
+	require.Len(t, releases, 4)
+	assert.Equal(t, "v0.3.0-rc1", releases[0].Tag)
+	assert.True(t, releases[0].Prerelease)
+	assert.True(t, releases[2].Draft)
+	assert.Equal(t, "v0.1.0", releases[3].Tag)
+
+	release := releases[1]
+	assert.Equal(t, "v0.2.0", release.Tag)
+	assert.Equal(t, "Release v0.2.0", release.Name)
+	assert.Equal(t, "Notes", release.Notes)
+	assert.Equal(t, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), release.PublishedAt)
+	assert.Empty(t, release.Digest)
+}
+
+func TestFetchRelease(t *testing.T) {
+	server := newTestAPI(t)
+	src := NewEnterpriseSource(server.URL, testToken)
+
+	release, err := src.FetchRelease("org/repo", "v0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", release.Tag)
+	assert.Equal(t, "abcd1234", release.Digest)
+	require.Len(t, release.Assets, 2)
+	hash := release.Asset(DigestAsset)
+	require.NotNil(t, hash)
+	assert.EqualValues(t, 9, hash.Size)
+	assert.Nil(t, release.Asset("missing"))
+
+	latest, err := src.FetchLatestRelease("org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, release, latest)
+
+	_, err = src.FetchRelease("org/repo", "v9.9.9")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
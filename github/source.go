@@ -0,0 +1,250 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinfoilsh/verifier/util"
+)
+
+// DefaultMaxPages limits how many pages of a paginated listing are fetched
+const DefaultMaxPages = 10
+
+// Source fetches releases and attestations from the GitHub REST API, GitHub Enterprise Server or a proxy of either
+type Source struct {
+	// APIURL is the base URL of the REST API, such as https://api.github.com or https://github.example.com/api/v3
+	APIURL string
+	// AttestationURL is the base URL attestations are fetched from. Empty uses APIURL.
+	AttestationURL string
+	// DownloadURL is the base URL release assets are downloaded from by path, as on github.com.
+	// Empty downloads assets through the REST API, which also works for private repos.
+	DownloadURL string
+	// Token authenticates requests; empty sends unauthenticated requests
+	Token string
+	// Transport makes the requests; nil uses util.Fetch, which uses http.DefaultTransport or, under WASM, the browser's fetch API
+	Transport http.RoundTripper
+	// MaxPages limits how many pages of a listing are fetched. Zero uses DefaultMaxPages.
+	MaxPages int
+	// ServerURL is the web URL of the GitHub Enterprise Server the repos are hosted on, whose workflows sign
+	// their attestations. Empty means github.com.
+	ServerURL string
+}
+
+// DefaultSource fetches through Tinfoil's caching proxies of the GitHub API, which need no token
+var DefaultSource = &Source{
+	APIURL:         "https://api-github-proxy.tinfoil.sh",
+	AttestationURL: "https://gh-attestation-proxy.tinfoil.sh",
+	DownloadURL:    "https://api-github-proxy.tinfoil.sh",
+}
+
+// NewGitHubSource fetches directly from api.github.com, authenticated with token if it is not empty
+func NewGitHubSource(token string) *Source {
+	return &Source{APIURL: "https://api.github.com", Token: token}
+}
+
+// NewEnterpriseSource fetches from the GitHub Enterprise Server at baseURL, such as https://github.example.com.
+// Attestations are expected to be signed by the server's workflows, see sigstore.EnterpriseIdentityPolicy.
+func NewEnterpriseSource(baseURL, token string) *Source {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &Source{APIURL: baseURL + "/api/v3", Token: token, ServerURL: baseURL}
+}
+
+// RateLimitError is returned when the API refuses a request because the rate limit is exhausted
+type RateLimitError struct {
+	URL string
+	// Reset is when requests are allowed again, or zero if the API did not say
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return fmt.Sprintf("GitHub API rate limit exceeded for %s", e.URL)
+	}
+	return fmt.Sprintf("GitHub API rate limit exceeded for %s, resets at %s", e.URL, e.Reset.Format(time.RFC3339))
+}
+
+// ErrNotFound is returned when the requested release, asset or attestation does not exist
+var ErrNotFound = errors.New("not found")
+
+// FetchLatestDigest gets the attestation digest of a repo's latest release
+func (s *Source) FetchLatestDigest(repo string) (string, error) {
+	latestTag, err := s.FetchLatestTag(repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch latest tag: %v", err)
+	}
+	digest, err := s.FetchDigest(repo, latestTag)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch digest for %s@%s: %v", repo, latestTag, err)
+	}
+	return digest, nil
+}
+
+// FetchAttestationBundles fetches every sigstore bundle attested for the EIF hash in a repo
+func (s *Source) FetchAttestationBundles(repo, digest string) ([][]byte, error) {
+	attestationURL := s.AttestationURL
+	if attestationURL == "" {
+		attestationURL = s.apiURL()
+	}
+
+	var bundles [][]byte
+	err := s.getPages(strings.TrimSuffix(attestationURL, "/")+"/repos/"+repo+"/attestations/sha256:"+digest, func(page []byte) error {
+		var response struct {
+			Attestations []struct {
+				Bundle json.RawMessage `json:"bundle"`
+			} `json:"attestations"`
+		}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return err
+		}
+		for _, attestation := range response.Attestations {
+			bundles = append(bundles, attestation.Bundle)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bundles) == 0 {
+		return nil, fmt.Errorf("no attestations found for digest %s", digest)
+	}
+	return bundles, nil
+}
+
+func (s *Source) apiURL() string {
+	return strings.TrimSuffix(s.APIURL, "/")
+}
+
+func (s *Source) getJSON(url string, v any) error {
+	body, _, err := s.get(url, "")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// ErrTooManyPages is returned when a listing has more pages than the source's MaxPages
+var ErrTooManyPages = errors.New("too many pages")
+
+// getPages fetches url and the pages after it linked by the Link header. A listing longer than MaxPages is an error
+// rather than being cut short, since a missing page could hold the release or attestation being looked for.
+func (s *Source) getPages(url string, page func([]byte) error) error {
+	maxPages := s.MaxPages
+	if maxPages == 0 {
+		maxPages = DefaultMaxPages
+	}
+	first, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+	for i := 0; url != ""; i++ {
+		if i == maxPages {
+			return fmt.Errorf("listing %s: %w: more than %d", first, ErrTooManyPages, maxPages)
+		}
+		body, header, err := s.get(url, "")
+		if err != nil {
+			return err
+		}
+		if err := page(body); err != nil {
+			return err
+		}
+		url = nextPage(header.Get("Link"))
+		if url == "" {
+			break
+		}
+		// The token must not be sent to another host
+		if next, err := neturl.Parse(url); err != nil || next.Host != first.Host {
+			return fmt.Errorf("listing %s: next page %q is not on the same host", first, url)
+		}
+	}
+	return nil
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPage returns the URL of the next page from a Link header, or an empty string on the last page
+func nextPage(link string) string {
+	if match := nextLink.FindStringSubmatch(link); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// get fetches url, sending the token and the accept header if set.
+// Without a transport the request goes through util.Fetch, which uses the browser's fetch API under WASM.
+func (s *Source) get(url, accept string) ([]byte, http.Header, error) {
+	header := http.Header{}
+	if accept == "" {
+		accept = "application/vnd.github+json"
+	}
+	header.Set("Accept", accept)
+	if s.Token != "" {
+		header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	status, respHeader, body, err := s.fetch(url, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := rateLimited(url, status, respHeader); err != nil {
+		return nil, nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil, fmt.Errorf("HTTP GET %s: %w", url, ErrNotFound)
+	}
+	if status > 299 {
+		return nil, nil, fmt.Errorf("HTTP GET %s: %d %s", url, status, http.StatusText(status))
+	}
+	return body, respHeader, nil
+}
+
+func (s *Source) fetch(url string, header http.Header) (int, http.Header, []byte, error) {
+	if s.Transport == nil {
+		return util.Fetch(url, header)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header = header
+	resp, err := (&http.Client{Transport: s.Transport}).Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// rateLimited returns a RateLimitError if the response refuses the request because of the primary or a secondary rate limit
+func rateLimited(url string, status int, header http.Header) error {
+	if status != http.StatusForbidden && status != http.StatusTooManyRequests {
+		return nil
+	}
+	if retryAfter, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		return &RateLimitError{URL: url, Reset: time.Now().Add(time.Duration(retryAfter) * time.Second)}
+	}
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		limitErr := &RateLimitError{URL: url}
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			limitErr.Reset = time.Unix(reset, 0)
+		}
+		return limitErr
+	}
+	if status == http.StatusTooManyRequests {
+		return &RateLimitError{URL: url}
+	}
+	return nil
+}
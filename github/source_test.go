@@ -0,0 +1,189 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test-token"
+
+func testRelease(serverURL string) map[string]any {
+	return map[string]any{
+		"tag_name":     "v0.2.0",
+		"name":         "Release v0.2.0",
+		"published_at": "2026-10-01T12:00:00Z",
+		"body":         "Notes",
+		"assets": []map[string]any{
+			{"name": "tinfoil.eif", "size": 1024, "url": serverURL + "/api/v3/repos/org/repo/releases/assets/1"},
+			{"name": "tinfoil.hash", "size": 9, "url": serverURL + "/api/v3/repos/org/repo/releases/assets/2"},
+		},
+	}
+}
+
+// newTestAPI serves a stand-in for the GitHub REST API with two pages of releases and attestations
+func newTestAPI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+
+	mux.HandleFunc("GET /api/v3/repos/org/repo/releases", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			json.NewEncoder(w).Encode([]map[string]any{{"tag_name": "v0.1.0"}})
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/org/repo/releases?per_page=100&page=2>; rel="next", <%s/api/v3/repos/org/repo/releases?per_page=100&page=2>; rel="last"`, server.URL, server.URL))
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"tag_name": "v0.3.0-rc1", "prerelease": true},
+			{"tag_name": "v0.2.0", "name": "Release v0.2.0", "published_at": "2026-10-01T12:00:00Z", "body": "Notes"},
+			{"tag_name": "v0.2.1", "draft": true},
+		})
+	})
+	mux.HandleFunc("GET /api/v3/repos/org/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(testRelease(server.URL))
+	})
+	mux.HandleFunc("GET /api/v3/repos/org/repo/releases/tags/v0.2.0", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(testRelease(server.URL))
+	})
+	mux.HandleFunc("GET /api/v3/repos/org/repo/releases/assets/2", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			http.Error(w, "asset metadata", http.StatusUnsupportedMediaType)
+			return
+		}
+		fmt.Fprintln(w, "abcd1234")
+	})
+	mux.HandleFunc("GET /api/v3/repos/org/repo/attestations/{digest}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("digest") != "sha256:abcd1234" {
+			json.NewEncoder(w).Encode(map[string]any{"attestations": []any{}})
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			json.NewEncoder(w).Encode(map[string]any{"attestations": []any{map[string]any{"bundle": map[string]any{"n": 2}}}})
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/org/repo/attestations/sha256:abcd1234?page=2>; rel="next"`, server.URL))
+		json.NewEncoder(w).Encode(map[string]any{"attestations": []any{map[string]any{"bundle": map[string]any{"n": 1}}}})
+	})
+	mux.HandleFunc("GET /org/repo/releases/download/v0.2.0/tinfoil.hash", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "abcd1234")
+	})
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEnterpriseSource(t *testing.T) {
+	server := newTestAPI(t)
+	src := NewEnterpriseSource(server.URL+"/", testToken)
+	assert.Equal(t, server.URL, src.ServerURL)
+
+	tag, err := src.FetchLatestTag("org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", tag)
+
+	tags, err := src.FetchReleaseTags("org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v0.2.0", "v0.1.0"}, tags)
+
+	digest, err := src.FetchDigest("org/repo", "v0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "abcd1234", digest)
+
+	digest, err = src.FetchLatestDigest("org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, "abcd1234", digest)
+
+	bundles, err := src.FetchAttestationBundles("org/repo", "abcd1234")
+	require.NoError(t, err)
+	require.Len(t, bundles, 2)
+	assert.JSONEq(t, `{"n": 1}`, string(bundles[0]))
+	assert.JSONEq(t, `{"n": 2}`, string(bundles[1]))
+
+	_, err = src.FetchAttestationBundles("org/repo", "ffff")
+	assert.ErrorContains(t, err, "no attestations found")
+
+	_, err = src.FetchDigest("org/repo", "v9.9.9")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSourceMaxPages(t *testing.T) {
+	server := newTestAPI(t)
+	src := NewEnterpriseSource(server.URL, testToken)
+	src.MaxPages = 1
+
+	// A listing is never cut short, since the missing page could hold the release being looked for
+	_, err := src.FetchReleaseTags("org/repo")
+	assert.ErrorIs(t, err, ErrTooManyPages)
+
+	src.MaxPages = 2
+	tags, err := src.FetchReleaseTags("org/repo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v0.2.0", "v0.1.0"}, tags)
+}
+
+func TestSourceDownloadURL(t *testing.T) {
+	server := newTestAPI(t)
+	src := &Source{APIURL: server.URL + "/api/v3", DownloadURL: server.URL, Token: testToken}
+
+	digest, err := src.FetchDigest("org/repo", "v0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "abcd1234", digest)
+}
+
+func TestSourceToken(t *testing.T) {
+	server := newTestAPI(t)
+
+	_, err := NewEnterpriseSource(server.URL, "wrong").FetchLatestTag("org/repo")
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestSourceRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/org/primary/releases/latest":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+			http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+		case "/repos/org/secondary/releases/latest":
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "secondary rate limit", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	src := &Source{APIURL: server.URL}
+
+	_, err := src.FetchLatestTag("org/primary")
+	var limitErr *RateLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.True(t, reset.Equal(limitErr.Reset))
+
+	_, err = src.FetchLatestTag("org/secondary")
+	require.ErrorAs(t, err, &limitErr)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), limitErr.Reset, 5*time.Second)
+
+	_, err = src.FetchLatestTag("org/private")
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &limitErr))
+}
+
+func TestNextPage(t *testing.T) {
+	assert.Equal(t, "https://api.github.com/x?page=3", nextPage(`<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=3>; rel="next"`))
+	assert.Empty(t, nextPage(`<https://api.github.com/x?page=1>; rel="prev"`))
+	assert.Empty(t, nextPage(""))
+}
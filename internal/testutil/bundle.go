@@ -0,0 +1,32 @@
+// Package testutil holds helpers shared by the tests of several packages
+package testutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// BundleMediaType is the media type of the bundles returned by Bundle
+const BundleMediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+
+// Bundle returns an unsigned bundle whose DSSE envelope carries an in-toto statement with the predicate type
+func Bundle(t testing.TB, predicateType string) []byte {
+	statement, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"predicateType": predicateType,
+		"predicate":     map[string]any{},
+	})
+	require.NoError(t, err)
+	bundle, err := json.Marshal(map[string]any{
+		"mediaType": BundleMediaType,
+		"dsseEnvelope": map[string]any{
+			"payload":     base64.StdEncoding.EncodeToString(statement),
+			"payloadType": "application/vnd.in-toto+json",
+		},
+	})
+	require.NoError(t, err)
+	return bundle
+}
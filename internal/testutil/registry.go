@@ -0,0 +1,68 @@
+package testutil
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// pushReferrer pushes an artifact with a single layer that refers to the subject image
+func pushReferrer(t testing.TB, repository string, subject v1.Image, artifactType string, content []byte) {
+	subjectDigest, err := subject.Digest()
+	require.NoError(t, err)
+	subjectManifest, err := subject.RawManifest()
+	require.NoError(t, err)
+	subjectMediaType, err := subject.MediaType()
+	require.NoError(t, err)
+
+	artifact := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.MediaType(artifactType))
+	artifact, err = mutate.Append(artifact, mutate.Addendum{Layer: static.NewLayer(content, types.MediaType(artifactType))})
+	require.NoError(t, err)
+	artifact = mutate.Subject(artifact, v1.Descriptor{
+		MediaType: subjectMediaType,
+		Size:      int64(len(subjectManifest)),
+		Digest:    subjectDigest,
+	}).(v1.Image)
+
+	artifactDigest, err := artifact.Digest()
+	require.NoError(t, err)
+	ref, err := name.NewDigest(repository + "@" + artifactDigest.String())
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, artifact))
+}
+
+// NewRegistry starts a local registry holding an image with a sigstore bundle and an SBOM as referrers.
+// It returns the image repository, the hex digest of the image and the bundle.
+func NewRegistry(t testing.TB, referrers bool) (repository, digest string, bundle []byte) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0)), registry.WithReferrersSupport(referrers)))
+	t.Cleanup(server.Close)
+	repository = strings.TrimPrefix(server.URL, "http://") + "/org/image"
+
+	image, err := random.Image(256, 1)
+	require.NoError(t, err)
+	tag, err := name.NewTag(repository + ":latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(tag, image))
+	hash, err := image.Digest()
+	require.NoError(t, err)
+
+	bundle = Bundle(t, string(attestation.SnpTdxMultiPlatformV1))
+	pushReferrer(t, repository, image, "application/spdx+json", []byte(`{"spdxVersion": "SPDX-2.3"}`))
+	pushReferrer(t, repository, image, BundleMediaType, bundle)
+	return repository, hash.Hex, bundle
+}
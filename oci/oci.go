@@ -0,0 +1,86 @@
+package oci
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+// bundleMediaType prefixes the artifact and layer media types of sigstore bundles, such as application/vnd.dev.sigstore.bundle.v0.3+json
+const bundleMediaType = "application/vnd.dev.sigstore.bundle"
+
+// FetchAttestationBundles fetches the sigstore bundles attached as OCI referrers to the image with the hex sha256 digest
+// in a repository such as ghcr.io/org/image. Options such as remote.WithAuthFromKeychain(authn.DefaultKeychain)
+// authenticate to private registries. Registries without the referrers API are queried through the fallback tag.
+func FetchAttestationBundles(repository, digest string, opts ...remote.Option) ([][]byte, error) {
+	ref, err := name.NewDigest(repository + "@sha256:" + digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	index, err := remote.Referrers(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching referrers of %s: %w", ref, err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("parsing referrers of %s: %w", ref, err)
+	}
+
+	var bundles [][]byte
+	for _, desc := range manifest.Manifests {
+		// Registries may ignore an artifactType filter, so referrers are filtered here
+		if !strings.HasPrefix(desc.ArtifactType, bundleMediaType) {
+			continue
+		}
+		artifact, err := remote.Image(ref.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("fetching referrer %s: %w", desc.Digest, err)
+		}
+		layers, err := artifact.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("reading referrer %s: %w", desc.Digest, err)
+		}
+		for _, layer := range layers {
+			mediaType, err := layer.MediaType()
+			if err != nil || !strings.HasPrefix(string(mediaType), bundleMediaType) {
+				continue
+			}
+			bundle, err := readLayer(layer.Compressed)
+			if err != nil {
+				return nil, fmt.Errorf("fetching bundle of referrer %s: %w", desc.Digest, err)
+			}
+			bundles = append(bundles, bundle)
+		}
+	}
+
+	if len(bundles) == 0 {
+		return nil, fmt.Errorf("no sigstore bundles refer to %s", ref)
+	}
+	return bundles, nil
+}
+
+// readLayer reads a layer's blob, which for a bundle is the bundle JSON as is
+func readLayer(open func() (io.ReadCloser, error)) ([]byte, error) {
+	blob, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return io.ReadAll(blob)
+}
+
+// VerifyAttestations fetches the sigstore bundles referring to the image with the digest and verifies them like
+// the GitHub attestations of a release: the bundles must be signed by a workflow of the GitHub repo and attest the digest.
+func VerifyAttestations(c *sigstore.Client, repository, repo, digest string, opts ...remote.Option) (*sigstore.VerifiedAttestation, []sigstore.SkippedBundle, error) {
+	bundles, err := FetchAttestationBundles(repository, digest, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.VerifyAttestations(bundles, repo, digest)
+}
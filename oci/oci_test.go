@@ -0,0 +1,49 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/internal/testutil"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+func TestFetchAttestationBundles(t *testing.T) {
+	for _, referrers := range []bool{true, false} {
+		t.Run(fmt.Sprintf("referrers=%v", referrers), func(t *testing.T) {
+			repository, digest, bundle := testutil.NewRegistry(t, referrers)
+
+			bundles, err := FetchAttestationBundles(repository, digest)
+			require.NoError(t, err)
+			require.Len(t, bundles, 1)
+			assert.JSONEq(t, string(bundle), string(bundles[0]))
+
+			_, err = FetchAttestationBundles(repository, strings.Repeat("0", 64))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifyAttestations(t *testing.T) {
+	repository, digest, _ := testutil.NewRegistry(t, true)
+	trustRootJSON, err := os.ReadFile("../client/trusted_root.json")
+	require.NoError(t, err)
+	client, err := sigstore.NewClientFromJSON(trustRootJSON)
+	require.NoError(t, err)
+
+	// The unsigned bundle is fetched and selected as a candidate but fails verification
+	verified, skipped, err := VerifyAttestations(client, repository, "org/repo", digest)
+	assert.ErrorIs(t, err, sigstore.ErrNoMatchingAttestation)
+	assert.Nil(t, verified)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, string(attestation.SnpTdxMultiPlatformV1), skipped[0].PredicateType)
+
+	_, _, err = VerifyAttestations(client, repository, "org/repo", "not a digest")
+	assert.ErrorContains(t, err, "invalid image reference")
+}
@@ -0,0 +1,154 @@
+package sigstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sigstore/sigstore-go/pkg/verify"
+
+	"github.com/tinfoilsh/verifier/attestation"
+)
+
+// ErrNoMatchingAttestation is returned when none of a digest's attestation bundles has a supported predicate and passes verification
+var ErrNoMatchingAttestation = errors.New("no attestation with a supported predicate passed verification")
+
+// ErrRefMismatch is returned when an attestation was built from a git ref other than the release tag it was fetched for
+var ErrRefMismatch = errors.New("attested ref does not match the release tag")
+
+// SkippedBundle records why one of a digest's attestation bundles was not used
+type SkippedBundle struct {
+	// Index is the position of the bundle in the list of attestations
+	Index int
+	// PredicateType is read from the bundle before verification and may be empty
+	PredicateType string
+	Err           error
+}
+
+func (s SkippedBundle) String() string {
+	return fmt.Sprintf("%s: %v", s.label(), s.Err)
+}
+
+func (s SkippedBundle) label() string {
+	if s.PredicateType == "" {
+		return fmt.Sprintf("attestation %d", s.Index)
+	}
+	return fmt.Sprintf("attestation %d (%s)", s.Index, s.PredicateType)
+}
+
+// VerifiedAttestation is the code measurement of a verified attestation bundle and where the bundle was logged and signed
+type VerifiedAttestation struct {
+	Measurement *attestation.Measurement
+	Provenance  *Provenance
+}
+
+// VerifyAttestations selects the code measurement among a digest's attestation bundles, such as SLSA provenance,
+// an SBOM and the measurement predicate. It returns the measurement of the first bundle with a supported measurement
+// predicate that passes verification, and why each bundle with another predicate, or failing verification, was skipped.
+func (c *Client) VerifyAttestations(bundles [][]byte, repo, hexDigest string) (*VerifiedAttestation, []SkippedBundle, error) {
+	return c.verifyAttestations(bundles, repo, "", hexDigest)
+}
+
+// VerifyReleaseAttestations is VerifyAttestations for the digest published with a release. Only a bundle whose
+// certificate records the build ran on refs/tags/<tag> is accepted, so a digest served for the wrong tag,
+// such as an older validly signed one, is rejected with ErrRefMismatch. This binds the digest to the tag only:
+// it cannot tell whether tag is the release the caller should be running.
+func (c *Client) VerifyReleaseAttestations(bundles [][]byte, repo, tag, hexDigest string) (*VerifiedAttestation, []SkippedBundle, error) {
+	if tag == "" {
+		return nil, nil, errors.New("release tag is required")
+	}
+	return c.verifyAttestations(bundles, repo, tag, hexDigest)
+}
+
+func (c *Client) verifyAttestations(bundles [][]byte, repo, tag, hexDigest string) (*VerifiedAttestation, []SkippedBundle, error) {
+	result, provenance, skipped, err := c.selectBundle(bundles, repo, tag, hexDigest, c.identity, func(predicateType attestation.PredicateType) bool {
+		return predicateType == attestation.SnpTdxMultiPlatformV1
+	})
+	if err != nil {
+		return nil, skipped, err
+	}
+	measurement, err := measurementFromResult(result)
+	if err != nil {
+		return nil, skipped, err
+	}
+	return &VerifiedAttestation{Measurement: measurement, Provenance: provenance}, skipped, nil
+}
+
+// selectBundle verifies the bundles whose predicate type is supported in order and returns the first that passes.
+// If tag is set, the bundle must also have been built from that tag.
+func (c *Client) selectBundle(
+	bundles [][]byte,
+	repo, tag, hexDigest string,
+	identity IdentityPolicy,
+	supported func(attestation.PredicateType) bool,
+) (*verify.VerificationResult, *Provenance, []SkippedBundle, error) {
+	// Predicate types are read up front so that every unsupported bundle is reported, not only those before the match
+	var candidates []int
+	var skipped []SkippedBundle
+	predicateTypes := make([]string, len(bundles))
+	for i, bundleJSON := range bundles {
+		predicateType, err := bundlePredicateType(bundleJSON)
+		predicateTypes[i] = predicateType
+		switch {
+		case err != nil:
+			skipped = append(skipped, SkippedBundle{Index: i, Err: err})
+		case !supported(attestation.PredicateType(predicateType)):
+			skipped = append(skipped, SkippedBundle{Index: i, PredicateType: predicateType, Err: errors.New("unsupported predicate type")})
+		default:
+			candidates = append(candidates, i)
+		}
+	}
+
+	for _, i := range candidates {
+		result, provenance, err := c.verifyBundle(bundles[i], repo, hexDigest, identity)
+		if err != nil {
+			skipped = append(skipped, SkippedBundle{Index: i, PredicateType: predicateTypes[i], Err: err})
+			continue
+		}
+		// The verified statement, not the unverified peek, decides the predicate type
+		if !supported(attestation.PredicateType(result.Statement.PredicateType)) {
+			skipped = append(skipped, SkippedBundle{Index: i, PredicateType: result.Statement.PredicateType, Err: errors.New("unsupported predicate type")})
+			continue
+		}
+		// A reproducible build may attest the same digest for several tags, so a mismatch skips the bundle
+		if err := provenance.checkTag(tag); err != nil {
+			skipped = append(skipped, SkippedBundle{Index: i, PredicateType: predicateTypes[i], Err: err})
+			continue
+		}
+		return result, provenance, skipped, nil
+	}
+
+	reasons := make([]error, len(skipped))
+	for i, s := range skipped {
+		reasons[i] = fmt.Errorf("%s: %w", s.label(), s.Err)
+	}
+	return nil, nil, skipped, fmt.Errorf("%w among %d attestations of %s: %w", ErrNoMatchingAttestation, len(bundles), hexDigest, errors.Join(reasons...))
+}
+
+// bundlePredicateType reads the predicate type of the in-toto statement in a bundle's DSSE envelope without verifying it
+func bundlePredicateType(bundleJSON []byte) (string, error) {
+	var bundle struct {
+		DSSEEnvelope *struct {
+			Payload string `json:"payload"`
+		} `json:"dsseEnvelope"`
+	}
+	if err := json.Unmarshal(bundleJSON, &bundle); err != nil {
+		return "", fmt.Errorf("parsing bundle: %w", err)
+	}
+	if bundle.DSSEEnvelope == nil {
+		return "", errors.New("bundle has no DSSE envelope")
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(bundle.DSSEEnvelope.Payload)
+	if err != nil {
+		return "", fmt.Errorf("decoding DSSE payload: %w", err)
+	}
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+	}
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return "", fmt.Errorf("parsing in-toto statement: %w", err)
+	}
+	return statement.PredicateType, nil
+}
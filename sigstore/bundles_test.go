@@ -0,0 +1,69 @@
+package sigstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/internal/testutil"
+)
+
+func TestBundlePredicateType(t *testing.T) {
+	predicateType, err := bundlePredicateType(testutil.Bundle(t, "https://slsa.dev/provenance/v1"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://slsa.dev/provenance/v1", predicateType)
+
+	_, err = bundlePredicateType([]byte(`{"messageSignature": {}}`))
+	assert.ErrorContains(t, err, "no DSSE envelope")
+	_, err = bundlePredicateType([]byte(`{"dsseEnvelope": {"payload": "not base64!"}}`))
+	assert.Error(t, err)
+	_, err = bundlePredicateType([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestVerifyAttestationsReportsSkipped(t *testing.T) {
+	client, err := NewClientFromJSON(testTrustRoot(t))
+	require.NoError(t, err)
+
+	bundles := [][]byte{
+		testutil.Bundle(t, "https://slsa.dev/provenance/v1"),
+		testutil.Bundle(t, "https://spdx.dev/Document/v2.3"),
+		[]byte(`{"messageSignature": {}}`),
+		testutil.Bundle(t, string(attestation.SnpTdxMultiPlatformV1)),
+	}
+	const digest = "7e76d5a6d81f19ecdc1f3c18c8f0cf5b89d22ea107a05a1ae23ce46e79270f26"
+	verified, skipped, err := client.VerifyAttestations(bundles, "tinfoilsh/repo", digest)
+	assert.ErrorIs(t, err, ErrNoMatchingAttestation)
+	assert.Nil(t, verified)
+
+	require.Len(t, skipped, 4)
+	assert.Equal(t, 0, skipped[0].Index)
+	assert.Equal(t, "https://slsa.dev/provenance/v1", skipped[0].PredicateType)
+	assert.ErrorContains(t, skipped[0].Err, "unsupported predicate type")
+	assert.Equal(t, "https://spdx.dev/Document/v2.3", skipped[1].PredicateType)
+	assert.Equal(t, 2, skipped[2].Index)
+	assert.Empty(t, skipped[2].PredicateType)
+	// The unsigned measurement bundle is a candidate but fails verification
+	assert.Equal(t, 3, skipped[3].Index)
+	assert.Equal(t, string(attestation.SnpTdxMultiPlatformV1), skipped[3].PredicateType)
+	assert.Error(t, skipped[3].Err)
+	assert.NotContains(t, skipped[3].Err.Error(), "unsupported predicate type")
+
+	assert.ErrorContains(t, err, "attestation 0 (https://slsa.dev/provenance/v1): unsupported predicate type")
+}
+
+func TestVerifyReleaseAttestations(t *testing.T) {
+	client, err := NewClientFromJSON(testTrustRoot(t))
+	require.NoError(t, err)
+
+	bundles := [][]byte{testutil.Bundle(t, string(attestation.SnpTdxMultiPlatformV1))}
+	const digest = "7e76d5a6d81f19ecdc1f3c18c8f0cf5b89d22ea107a05a1ae23ce46e79270f26"
+	_, _, err = client.VerifyReleaseAttestations(bundles, "tinfoilsh/repo", "", digest)
+	assert.ErrorContains(t, err, "release tag is required")
+
+	_, skipped, err := client.VerifyReleaseAttestations(bundles, "tinfoilsh/repo", "v1.2.3", digest)
+	assert.ErrorIs(t, err, ErrNoMatchingAttestation)
+	assert.Len(t, skipped, 1)
+}
@@ -0,0 +1,184 @@
+package sigstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/github"
+)
+
+// DefaultHardwareRepo publishes the measurements of the TDX hardware platforms Tinfoil runs on
+const DefaultHardwareRepo = "tinfoilsh/hardware-measurements"
+
+// HardwareProvider supplies the hardware platform measurements TDX enclaves are verified against.
+// The client verifies the measurements' attestations if the provider fetches them from a release.
+type HardwareProvider interface {
+	HardwareMeasurements(c *Client) ([]*attestation.HardwareMeasurement, error)
+}
+
+// HardwareFingerprinter is a provider that describes the measurements it supplies with a string that is stable
+// across processes, such as to key stored verification results by. The built-in providers implement it.
+// Fingerprint returns false if the provider has no stable description.
+type HardwareFingerprinter interface {
+	HardwareProvider
+	Fingerprint() (string, bool)
+}
+
+// hardwareFingerprint returns the fingerprint of provider if it has one
+func hardwareFingerprint(provider HardwareProvider) (string, bool) {
+	fingerprinter, ok := provider.(HardwareFingerprinter)
+	if !ok {
+		return "", false
+	}
+	return fingerprinter.Fingerprint()
+}
+
+// HardwareRepo fetches the hardware measurements attested for a release of a repo.
+// With neither Tag nor Digest set, the latest release is used.
+type HardwareRepo struct {
+	Repo string
+	// Tag pins the release. The attestation must have been built from the tag.
+	Tag string
+	// Digest pins the attested digest. If Tag is also set, the release's digest is not fetched.
+	Digest string
+	// Source is where releases and attestations are fetched from; nil uses github.DefaultSource
+	Source *github.Source
+}
+
+// HardwareMeasurements fetches and verifies the measurements of the repo's pinned or latest release
+func (r HardwareRepo) HardwareMeasurements(c *Client) ([]*attestation.HardwareMeasurement, error) {
+	src := r.Source
+	if src == nil {
+		src = github.DefaultSource
+	}
+
+	tag, digest := r.Tag, r.Digest
+	if tag == "" && digest == "" {
+		var err error
+		tag, err = src.FetchLatestTag(r.Repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch latest tag of %s: %v", r.Repo, err)
+		}
+	}
+	if digest == "" {
+		var err error
+		digest, err = src.FetchDigest(r.Repo, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch digest for %s@%s: %v", r.Repo, tag, err)
+		}
+	}
+	return c.fetchHardwareMeasurements(src, r.Repo, tag, digest)
+}
+
+// Fingerprint describes the pinned or latest release and where it is fetched from
+func (r HardwareRepo) Fingerprint() (string, bool) {
+	src := r.Source
+	if src == nil {
+		src = github.DefaultSource
+	}
+	return fmt.Sprintf("repo %q %q %q from %q %q %q %q", r.Repo, r.Tag, r.Digest, src.APIURL, src.AttestationURL, src.DownloadURL, src.ServerURL), true
+}
+
+// HardwareFile reads hardware measurements from a local JSON file holding an array of attestation.HardwareMeasurement.
+// The file is trusted as is, like measurements pinned in code.
+type HardwareFile string
+
+// HardwareMeasurements reads the file
+func (f HardwareFile) HardwareMeasurements(*Client) ([]*attestation.HardwareMeasurement, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	var measurements []*attestation.HardwareMeasurement
+	if err := json.Unmarshal(data, &measurements); err != nil {
+		return nil, fmt.Errorf("parsing hardware measurements from %s: %w", string(f), err)
+	}
+	return measurements, nil
+}
+
+// Fingerprint describes the file by its path
+func (f HardwareFile) Fingerprint() (string, bool) {
+	return fmt.Sprintf("file %q", string(f)), true
+}
+
+// MergedHardware merges the measurement sets of several providers, such as Tinfoil's repo and your own.
+// It fails if any provider fails. Identical measurements with the same ID are only included once,
+// and measurements with the same ID but different values are an error.
+type MergedHardware []HardwareProvider
+
+// HardwareMeasurements fetches the measurements of every provider
+func (m MergedHardware) HardwareMeasurements(c *Client) ([]*attestation.HardwareMeasurement, error) {
+	var merged []*attestation.HardwareMeasurement
+	seen := make(map[string]*attestation.HardwareMeasurement)
+	for _, provider := range m {
+		measurements, err := provider.HardwareMeasurements(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, measurement := range measurements {
+			if existing, ok := seen[measurement.ID]; ok {
+				if *existing != *measurement {
+					return nil, fmt.Errorf("conflicting hardware measurements for %s", measurement.ID)
+				}
+				continue
+			}
+			seen[measurement.ID] = measurement
+			merged = append(merged, measurement)
+		}
+	}
+	return merged, nil
+}
+
+// Fingerprint combines the fingerprints of the providers, failing if any has none
+func (m MergedHardware) Fingerprint() (string, bool) {
+	fingerprint := "merged"
+	for _, provider := range m {
+		f, ok := hardwareFingerprint(provider)
+		if !ok {
+			return "", false
+		}
+		fingerprint += fmt.Sprintf(" %q", f)
+	}
+	return fingerprint, true
+}
+
+// CachedHardware caches the measurements of a provider for a TTL. Failures are not cached.
+type CachedHardware struct {
+	provider HardwareProvider
+	ttl      time.Duration
+
+	mu           sync.Mutex
+	measurements []*attestation.HardwareMeasurement
+	expires      time.Time
+}
+
+// NewCachedHardware caches the measurements of provider for ttl
+func NewCachedHardware(provider HardwareProvider, ttl time.Duration) *CachedHardware {
+	return &CachedHardware{provider: provider, ttl: ttl}
+}
+
+// Fingerprint is the fingerprint of the cached provider
+func (h *CachedHardware) Fingerprint() (string, bool) {
+	return hardwareFingerprint(h.provider)
+}
+
+// HardwareMeasurements returns the cached measurements, fetching them from the provider once they have expired.
+// Concurrent callers wait for a single fetch.
+func (h *CachedHardware) HardwareMeasurements(c *Client) ([]*attestation.HardwareMeasurement, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.measurements != nil && time.Now().Before(h.expires) {
+		return h.measurements, nil
+	}
+
+	measurements, err := h.provider.HardwareMeasurements(c)
+	if err != nil {
+		return nil, err
+	}
+	h.measurements, h.expires = measurements, time.Now().Add(h.ttl)
+	return measurements, nil
+}
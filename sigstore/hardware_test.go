@@ -0,0 +1,156 @@
+package sigstore
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/attestation"
+	"github.com/tinfoilsh/verifier/github"
+	"github.com/tinfoilsh/verifier/internal/testutil"
+)
+
+// countingHardware returns a fixed set of measurements and counts how often it is asked
+type countingHardware struct {
+	mu           sync.Mutex
+	calls        int
+	measurements []*attestation.HardwareMeasurement
+	err          error
+}
+
+func (h *countingHardware) HardwareMeasurements(*Client) ([]*attestation.HardwareMeasurement, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	return h.measurements, h.err
+}
+
+func TestHardwareFile(t *testing.T) {
+	measurements := []*attestation.HardwareMeasurement{{ID: "hw1@abcd", MRTD: "mrtd", RTMR0: "rtmr0"}}
+	data, err := json.Marshal(measurements)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "hardware.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := HardwareFile(path).HardwareMeasurements(nil)
+	require.NoError(t, err)
+	assert.Equal(t, measurements, loaded)
+
+	_, err = HardwareFile(filepath.Join(t.TempDir(), "missing.json")).HardwareMeasurements(nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMergedHardware(t *testing.T) {
+	tinfoil := &countingHardware{measurements: []*attestation.HardwareMeasurement{{ID: "hw1@aaaa"}, {ID: "hw2@aaaa"}}}
+	own := &countingHardware{measurements: []*attestation.HardwareMeasurement{{ID: "hw2@aaaa"}, {ID: "custom@bbbb"}}}
+
+	merged, err := MergedHardware{tinfoil, own}.HardwareMeasurements(nil)
+	require.NoError(t, err)
+	var ids []string
+	for _, measurement := range merged {
+		ids = append(ids, measurement.ID)
+	}
+	assert.Equal(t, []string{"hw1@aaaa", "hw2@aaaa", "custom@bbbb"}, ids)
+
+	conflicting := &countingHardware{measurements: []*attestation.HardwareMeasurement{{ID: "hw1@aaaa", MRTD: "other"}}}
+	_, err = MergedHardware{tinfoil, conflicting}.HardwareMeasurements(nil)
+	assert.ErrorContains(t, err, "conflicting hardware measurements for hw1@aaaa")
+
+	own.err = errors.New("unavailable")
+	_, err = MergedHardware{tinfoil, own}.HardwareMeasurements(nil)
+	assert.ErrorContains(t, err, "unavailable")
+}
+
+func TestCachedHardware(t *testing.T) {
+	provider := &countingHardware{err: errors.New("unavailable")}
+	cached := NewCachedHardware(provider, time.Hour)
+
+	_, err := cached.HardwareMeasurements(nil)
+	assert.Error(t, err)
+
+	provider.err = nil
+	provider.measurements = []*attestation.HardwareMeasurement{{ID: "hw1@aaaa"}}
+	for range 3 {
+		measurements, err := cached.HardwareMeasurements(nil)
+		require.NoError(t, err)
+		assert.Len(t, measurements, 1)
+	}
+	assert.Equal(t, 2, provider.calls)
+
+	cached.expires = time.Now().Add(-time.Second)
+	_, err = cached.HardwareMeasurements(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, provider.calls)
+}
+
+func TestHardwareRepoPinned(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/repos/org/hardware/releases/latest":
+			json.NewEncoder(w).Encode(map[string]any{"tag_name": "v2"})
+		case "/org/hardware/releases/download/v2/tinfoil.hash", "/org/hardware/releases/download/v1/tinfoil.hash":
+			w.Write([]byte("abcd\n"))
+		case "/repos/org/hardware/attestations/sha256:abcd", "/repos/org/hardware/attestations/sha256:ef01":
+			bundle := testutil.Bundle(t, string(attestation.HardwareMeasurementsV1))
+			json.NewEncoder(w).Encode(map[string]any{"attestations": []any{map[string]any{"bundle": json.RawMessage(bundle)}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	src := &github.Source{APIURL: server.URL, DownloadURL: server.URL}
+
+	client, err := NewClientFromJSON(testTrustRoot(t))
+	require.NoError(t, err)
+
+	// The unsigned bundle fails verification, so only the requests made are checked
+	fetched := func(repo HardwareRepo) []string {
+		paths = nil
+		_, err := repo.HardwareMeasurements(client)
+		assert.ErrorIs(t, err, ErrNoMatchingAttestation)
+		return paths
+	}
+
+	assert.Equal(t, []string{
+		"/repos/org/hardware/releases/latest",
+		"/org/hardware/releases/download/v2/tinfoil.hash",
+		"/repos/org/hardware/attestations/sha256:abcd",
+	}, fetched(HardwareRepo{Repo: "org/hardware", Source: src}))
+	assert.Equal(t, []string{
+		"/org/hardware/releases/download/v1/tinfoil.hash",
+		"/repos/org/hardware/attestations/sha256:abcd",
+	}, fetched(HardwareRepo{Repo: "org/hardware", Tag: "v1", Source: src}))
+	assert.Equal(t, []string{
+		"/repos/org/hardware/attestations/sha256:ef01",
+	}, fetched(HardwareRepo{Repo: "org/hardware", Digest: "ef01", Source: src}))
+}
+
+func TestHardwareFingerprint(t *testing.T) {
+	repo := HardwareRepo{Repo: "org/hardware", Tag: "v1"}
+	fingerprint, ok := NewCachedHardware(repo, time.Hour).Fingerprint()
+	require.True(t, ok)
+	again, ok := NewCachedHardware(repo, time.Hour).Fingerprint()
+	require.True(t, ok)
+	assert.Equal(t, fingerprint, again)
+
+	other, ok := HardwareRepo{Repo: "org/hardware", Tag: "v1", Source: &github.Source{APIURL: "https://github.example.com/api/v3"}}.Fingerprint()
+	require.True(t, ok)
+	assert.NotEqual(t, fingerprint, other)
+
+	_, ok = MergedHardware{HardwareFile("hardware.json"), &countingHardware{}}.Fingerprint()
+	assert.False(t, ok)
+}
@@ -0,0 +1,135 @@
+package sigstore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// DefaultRefPattern matches any release tag
+const DefaultRefPattern = "refs/tags/.+"
+
+// DefaultServerURL is the GitHub instance repos are hosted on unless a policy sets another
+const DefaultServerURL = "https://github.com"
+
+// IdentityPolicy constrains the GitHub Actions workflow run whose Fulcio certificate signed a bundle.
+// The zero value accepts any workflow in the repo running on a tag.
+type IdentityPolicy struct {
+	// Workflow is the exact path of the signing workflow within the repo, e.g. ".github/workflows/release.yml".
+	// Empty accepts any workflow under .github/workflows.
+	Workflow string
+	// RefPatterns are regular expressions, one of which must match the entire git ref the workflow ran on,
+	// e.g. "refs/tags/v[0-9]+\\.[0-9]+\\.[0-9]+". Empty defaults to DefaultRefPattern.
+	RefPatterns []string
+	// RunnerEnvironment is the required runner environment, "github-hosted" or "self-hosted". Empty accepts either.
+	RunnerEnvironment string
+	// SourceRepositoryDigest is the required commit SHA the workflow ran on. Empty accepts any commit.
+	SourceRepositoryDigest string
+	// SourceRepositoryOwnerID is the required numeric GitHub ID of the repo owner, which unlike the owner name cannot be reclaimed
+	SourceRepositoryOwnerID string
+	// ServerURL is the web URL of the GitHub instance the repo is hosted on, such as https://github.example.com
+	// for GitHub Enterprise Server. Empty defaults to DefaultServerURL.
+	ServerURL string
+	// Issuer is the OIDC issuer of the instance's Actions tokens, https://<host>/_services/token on GitHub Enterprise Server.
+	// Empty defaults to the github.com issuer.
+	Issuer string
+}
+
+// EnterpriseIdentityPolicy returns the policy for workflows of the GitHub Enterprise Server at serverURL,
+// such as https://github.example.com, which accepts any workflow in the repo running on a tag
+func EnterpriseIdentityPolicy(serverURL string) IdentityPolicy {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	return IdentityPolicy{ServerURL: serverURL, Issuer: serverURL + "/_services/token"}
+}
+
+func (p IdentityPolicy) serverURL() string {
+	if p.ServerURL == "" {
+		return DefaultServerURL
+	}
+	return strings.TrimSuffix(p.ServerURL, "/")
+}
+
+func (p IdentityPolicy) issuer() string {
+	if p.Issuer == "" {
+		return oidcIssuer
+	}
+	return p.Issuer
+}
+
+// sanPattern returns the regular expression the certificate's subject alternative name must match
+func (p IdentityPolicy) sanPattern(repo string) (string, error) {
+	workflow := `\.github/workflows/[^@]+`
+	if p.Workflow != "" {
+		workflow = regexp.QuoteMeta(strings.TrimPrefix(p.Workflow, "/"))
+	}
+
+	refPatterns := p.RefPatterns
+	if len(refPatterns) == 0 {
+		refPatterns = []string{DefaultRefPattern}
+	}
+	refs := make([]string, len(refPatterns))
+	for i, pattern := range refPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return "", fmt.Errorf("invalid ref pattern %q: %w", pattern, err)
+		}
+		refs[i] = "(?:" + pattern + ")"
+	}
+
+	return "^" + regexp.QuoteMeta(p.serverURL()+"/"+repo) + "/" + workflow + "@(?:" + strings.Join(refs, "|") + ")$", nil
+}
+
+// certificateIdentity returns the certificate identity a bundle for the repo must be signed with
+func (p IdentityPolicy) certificateIdentity(repo string) (verify.CertificateIdentity, error) {
+	sanPattern, err := p.sanPattern(repo)
+	if err != nil {
+		return verify.CertificateIdentity{}, err
+	}
+	sanMatcher, err := verify.NewSANMatcher("", sanPattern)
+	if err != nil {
+		return verify.CertificateIdentity{}, err
+	}
+	issuerMatcher, err := verify.NewIssuerMatcher(p.issuer(), "")
+	if err != nil {
+		return verify.CertificateIdentity{}, err
+	}
+	return verify.NewCertificateIdentity(sanMatcher, issuerMatcher, certificate.Extensions{
+		RunnerEnvironment:               p.RunnerEnvironment,
+		SourceRepositoryDigest:          p.SourceRepositoryDigest,
+		SourceRepositoryOwnerIdentifier: p.SourceRepositoryOwnerID,
+	})
+}
+
+// CheckProvenance checks that a bundle verified earlier with the given provenance satisfies the policy for the repo,
+// such as when a stored ground truth is restored without verifying the bundle again
+func (p IdentityPolicy) CheckProvenance(repo string, provenance *Provenance) error {
+	if provenance == nil {
+		return fmt.Errorf("no provenance to check")
+	}
+	sanPattern, err := p.sanPattern(repo)
+	if err != nil {
+		return err
+	}
+	san, err := regexp.Compile(sanPattern)
+	if err != nil {
+		return fmt.Errorf("invalid identity policy: %v", err)
+	}
+	if !san.MatchString(provenance.SignerSAN) {
+		return fmt.Errorf("signer %q does not match the identity policy", provenance.SignerSAN)
+	}
+	if provenance.Issuer != p.issuer() {
+		return fmt.Errorf("issuer %q does not match the identity policy", provenance.Issuer)
+	}
+	if p.RunnerEnvironment != "" && provenance.RunnerEnvironment != p.RunnerEnvironment {
+		return fmt.Errorf("runner environment %q does not match the identity policy", provenance.RunnerEnvironment)
+	}
+	if p.SourceRepositoryDigest != "" && provenance.CommitSHA != p.SourceRepositoryDigest {
+		return fmt.Errorf("commit %q does not match the identity policy", provenance.CommitSHA)
+	}
+	if p.SourceRepositoryOwnerID != "" && provenance.OwnerID != p.SourceRepositoryOwnerID {
+		return fmt.Errorf("owner ID %q does not match the identity policy", provenance.OwnerID)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package sigstore
+
+import (
+	"testing"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func certSummary(san string, extensions certificate.Extensions) certificate.Summary {
+	extensions.Issuer = oidcIssuer
+	return certificate.Summary{
+		SubjectAlternativeName: san,
+		Extensions:             extensions,
+	}
+}
+
+func TestIdentityPolicyDefault(t *testing.T) {
+	identity, err := IdentityPolicy{}.certificateIdentity("tinfoilsh/repo")
+	require.NoError(t, err)
+
+	for san, ok := range map[string]bool{
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.0.0":  true,
+		"https://github.com/tinfoilsh/repo/.github/workflows/other.yml@refs/tags/v0.1":      true,
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/heads/main":   false,
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/":        false,
+		"https://github.com/tinfoilsh/repo-fork/.github/workflows/release.yml@refs/tags/v1": false,
+		"https://github.com/tinfoilshXrepo/.github/workflows/release.yml@refs/tags/v1":      false,
+	} {
+		err := identity.Verify(certSummary(san, certificate.Extensions{}))
+		if ok {
+			assert.NoError(t, err, san)
+		} else {
+			assert.Error(t, err, san)
+		}
+	}
+}
+
+func TestIdentityPolicyWorkflowAndRefs(t *testing.T) {
+	identity, err := IdentityPolicy{
+		Workflow:    ".github/workflows/release.yml",
+		RefPatterns: []string{`refs/tags/v[0-9]+\.[0-9]+\.[0-9]+`, "refs/heads/main"},
+	}.certificateIdentity("tinfoilsh/repo")
+	require.NoError(t, err)
+
+	for san, ok := range map[string]bool{
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3":    true,
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/heads/main":     true,
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3-rc": false,
+		"https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/heads/main2":    false,
+		"https://github.com/tinfoilsh/repo/.github/workflows/releaseXyml@refs/tags/v1.2.3":    false,
+		"https://github.com/tinfoilsh/repo/.github/workflows/other.yml@refs/tags/v1.2.3":      false,
+	} {
+		err := identity.Verify(certSummary(san, certificate.Extensions{}))
+		if ok {
+			assert.NoError(t, err, san)
+		} else {
+			assert.Error(t, err, san)
+		}
+	}
+}
+
+func TestIdentityPolicyExtensions(t *testing.T) {
+	const san = "https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1"
+	identity, err := IdentityPolicy{
+		RunnerEnvironment:       "github-hosted",
+		SourceRepositoryDigest:  "0123456789abcdef0123456789abcdef01234567",
+		SourceRepositoryOwnerID: "123456",
+	}.certificateIdentity("tinfoilsh/repo")
+	require.NoError(t, err)
+
+	matching := certificate.Extensions{
+		RunnerEnvironment:               "github-hosted",
+		SourceRepositoryDigest:          "0123456789abcdef0123456789abcdef01234567",
+		SourceRepositoryOwnerIdentifier: "123456",
+	}
+	assert.NoError(t, identity.Verify(certSummary(san, matching)))
+
+	selfHosted := matching
+	selfHosted.RunnerEnvironment = "self-hosted"
+	assert.Error(t, identity.Verify(certSummary(san, selfHosted)))
+
+	otherCommit := matching
+	otherCommit.SourceRepositoryDigest = "fedcba9876543210fedcba9876543210fedcba98"
+	assert.Error(t, identity.Verify(certSummary(san, otherCommit)))
+
+	otherOwner := matching
+	otherOwner.SourceRepositoryOwnerIdentifier = "654321"
+	assert.Error(t, identity.Verify(certSummary(san, otherOwner)))
+}
+
+func TestIdentityPolicyCheckProvenance(t *testing.T) {
+	provenance := &Provenance{
+		SignerSAN:         "https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3",
+		Issuer:            oidcIssuer,
+		CommitSHA:         "0123456789abcdef0123456789abcdef01234567",
+		RunnerEnvironment: "github-hosted",
+		OwnerID:           "123456",
+	}
+	assert.NoError(t, IdentityPolicy{}.CheckProvenance("tinfoilsh/repo", provenance))
+	assert.NoError(t, IdentityPolicy{
+		Workflow:                ".github/workflows/release.yml",
+		RunnerEnvironment:       "github-hosted",
+		SourceRepositoryDigest:  "0123456789abcdef0123456789abcdef01234567",
+		SourceRepositoryOwnerID: "123456",
+	}.CheckProvenance("tinfoilsh/repo", provenance))
+
+	assert.ErrorContains(t, IdentityPolicy{}.CheckProvenance("tinfoilsh/other", provenance), "signer")
+	assert.ErrorContains(t, IdentityPolicy{Workflow: ".github/workflows/build.yml"}.CheckProvenance("tinfoilsh/repo", provenance), "signer")
+	assert.ErrorContains(t, IdentityPolicy{RefPatterns: []string{`refs/tags/v2\..+`}}.CheckProvenance("tinfoilsh/repo", provenance), "signer")
+	assert.ErrorContains(t, IdentityPolicy{RunnerEnvironment: "self-hosted"}.CheckProvenance("tinfoilsh/repo", provenance), "runner environment")
+	assert.ErrorContains(t, IdentityPolicy{SourceRepositoryDigest: "fedcba9876543210fedcba9876543210fedcba98"}.CheckProvenance("tinfoilsh/repo", provenance), "commit")
+	assert.ErrorContains(t, IdentityPolicy{SourceRepositoryOwnerID: "654321"}.CheckProvenance("tinfoilsh/repo", provenance), "owner ID")
+	assert.Error(t, IdentityPolicy{}.CheckProvenance("tinfoilsh/repo", nil))
+
+	otherIssuer := *provenance
+	otherIssuer.Issuer = "https://accounts.example.com"
+	assert.ErrorContains(t, IdentityPolicy{}.CheckProvenance("tinfoilsh/repo", &otherIssuer), "issuer")
+}
+
+func TestIdentityPolicyEnterprise(t *testing.T) {
+	policy := EnterpriseIdentityPolicy("https://github.example.com/")
+	assert.Equal(t, "https://github.example.com", policy.ServerURL)
+	assert.Equal(t, "https://github.example.com/_services/token", policy.Issuer)
+	identity, err := policy.certificateIdentity("org/repo")
+	require.NoError(t, err)
+
+	enterprise := func(san string) certificate.Summary {
+		return certificate.Summary{
+			SubjectAlternativeName: san,
+			Extensions:             certificate.Extensions{Issuer: "https://github.example.com/_services/token"},
+		}
+	}
+	assert.NoError(t, identity.Verify(enterprise("https://github.example.com/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0")))
+	assert.Error(t, identity.Verify(enterprise("https://github.com/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0")))
+	assert.Error(t, identity.Verify(enterprise("https://github.example.com.evil/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0")))
+	// github.com's issuer does not vouch for the enterprise server's workflows
+	assert.Error(t, identity.Verify(certSummary("https://github.example.com/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0", certificate.Extensions{})))
+
+	provenance := &Provenance{
+		SignerSAN: "https://github.example.com/org/repo/.github/workflows/release.yml@refs/tags/v1.0.0",
+		Issuer:    "https://github.example.com/_services/token",
+	}
+	assert.NoError(t, policy.CheckProvenance("org/repo", provenance))
+	assert.ErrorContains(t, IdentityPolicy{}.CheckProvenance("org/repo", provenance), "signer")
+	assert.ErrorContains(t, IdentityPolicy{ServerURL: "https://github.example.com"}.CheckProvenance("org/repo", provenance), "issuer")
+}
+
+func TestIdentityPolicyInvalidRefPattern(t *testing.T) {
+	policy := IdentityPolicy{RefPatterns: []string{"refs/tags/("}}
+	_, err := policy.certificateIdentity("tinfoilsh/repo")
+	assert.Error(t, err)
+	assert.ErrorContains(t, policy.CheckProvenance("tinfoilsh/repo", &Provenance{}), "invalid ref pattern")
+}
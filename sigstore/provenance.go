@@ -0,0 +1,73 @@
+package sigstore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/tlog"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// Provenance records where a verified attestation bundle was logged and who signed it
+type Provenance struct {
+	// LogID is the hex-encoded ID of the Rekor log the bundle's entry is in
+	LogID string `json:"log_id,omitempty"`
+	// LogIndex is the index of the bundle's entry in the Rekor log
+	LogIndex int64 `json:"log_index"`
+	// IntegratedTime is when the entry was added to the log. It is zero for logs that do not record it.
+	IntegratedTime time.Time `json:"integrated_time,omitzero"`
+	// SignedTimestamps are the verified RFC 3161 timestamps from timestamp authorities
+	SignedTimestamps []time.Time `json:"signed_timestamps,omitempty"`
+
+	// SignerSAN is the subject alternative name of the Fulcio certificate, the signing workflow's URI
+	SignerSAN string `json:"signer_san"`
+	// Issuer is the OIDC issuer that vouched for the signer
+	Issuer string `json:"issuer"`
+	// WorkflowRef is the git ref the signing workflow ran on
+	WorkflowRef string `json:"workflow_ref,omitempty"`
+	// CommitSHA is the commit the signing workflow ran on
+	CommitSHA string `json:"commit_sha,omitempty"`
+	// RunnerEnvironment is the environment the signing workflow ran in, "github-hosted" or "self-hosted"
+	RunnerEnvironment string `json:"runner_environment,omitempty"`
+	// OwnerID is the numeric GitHub ID of the repo owner
+	OwnerID string `json:"owner_id,omitempty"`
+}
+
+// newProvenance collects the provenance of a verified bundle from its transparency log entries and verification result
+func newProvenance(entries []*tlog.Entry, result *verify.VerificationResult) *Provenance {
+	provenance := &Provenance{}
+	if len(entries) > 0 {
+		entry := entries[0]
+		provenance.LogID = hex.EncodeToString([]byte(entry.LogKeyID()))
+		provenance.LogIndex = entry.LogIndex()
+		if integratedTime := entry.IntegratedTime(); integratedTime.Unix() > 0 {
+			provenance.IntegratedTime = integratedTime.UTC()
+		}
+	}
+
+	for _, timestamp := range result.VerifiedTimestamps {
+		if timestamp.Type == "TimestampAuthority" {
+			provenance.SignedTimestamps = append(provenance.SignedTimestamps, timestamp.Timestamp.UTC())
+		}
+	}
+
+	if result.Signature != nil && result.Signature.Certificate != nil {
+		certificate := result.Signature.Certificate
+		provenance.SignerSAN = certificate.SubjectAlternativeName
+		provenance.Issuer = certificate.Issuer
+		provenance.WorkflowRef = certificate.SourceRepositoryRef
+		provenance.CommitSHA = certificate.SourceRepositoryDigest
+		provenance.RunnerEnvironment = certificate.RunnerEnvironment
+		provenance.OwnerID = certificate.SourceRepositoryOwnerIdentifier
+	}
+	return provenance
+}
+
+// checkTag returns ErrRefMismatch unless the signing workflow ran on the tag. An empty tag is not checked.
+func (p *Provenance) checkTag(tag string) error {
+	if tag == "" || p.WorkflowRef == "refs/tags/"+tag {
+		return nil
+	}
+	return fmt.Errorf("%w: built from %q, expected refs/tags/%s", ErrRefMismatch, p.WorkflowRef, tag)
+}
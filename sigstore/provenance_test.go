@@ -0,0 +1,92 @@
+package sigstore
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/testing/ca"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvenance(t *testing.T) {
+	signedAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	result := &verify.VerificationResult{
+		Signature: &verify.SignatureVerificationResult{
+			Certificate: &certificate.Summary{
+				SubjectAlternativeName: "https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3",
+				Extensions: certificate.Extensions{
+					Issuer:                          oidcIssuer,
+					SourceRepositoryRef:             "refs/tags/v1.2.3",
+					SourceRepositoryDigest:          "0123456789abcdef0123456789abcdef01234567",
+					RunnerEnvironment:               "github-hosted",
+					SourceRepositoryOwnerIdentifier: "123456",
+				},
+			},
+		},
+		VerifiedTimestamps: []verify.TimestampVerificationResult{
+			{Type: "Tlog", Timestamp: signedAt.Add(-time.Second)},
+			{Type: "TimestampAuthority", Timestamp: signedAt},
+		},
+	}
+
+	provenance := newProvenance(nil, result)
+	assert.Equal(t, "https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3", provenance.SignerSAN)
+	assert.Equal(t, oidcIssuer, provenance.Issuer)
+	assert.Equal(t, "refs/tags/v1.2.3", provenance.WorkflowRef)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", provenance.CommitSHA)
+	assert.Equal(t, "github-hosted", provenance.RunnerEnvironment)
+	assert.Equal(t, "123456", provenance.OwnerID)
+	assert.Equal(t, []time.Time{signedAt}, provenance.SignedTimestamps)
+
+	encoded, err := json.Marshal(provenance)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "integrated_time")
+	var decoded Provenance
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, *provenance, decoded)
+}
+
+func TestNewProvenanceFromBundle(t *testing.T) {
+	virtualSigstore, err := ca.NewVirtualSigstore()
+	require.NoError(t, err)
+	integratedTime := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	entity, err := virtualSigstore.AttestAtTime("https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3",
+		oidcIssuer, []byte(`{"_type": "https://in-toto.io/Statement/v1"}`), integratedTime, false)
+	require.NoError(t, err)
+
+	verifier, err := verify.NewSignedEntityVerifier(virtualSigstore,
+		verify.WithTransparencyLog(1),
+		verify.WithObserverTimestamps(1),
+	)
+	require.NoError(t, err)
+	result, err := verifier.Verify(entity, verify.NewPolicy(verify.WithoutArtifactUnsafe(), verify.WithoutIdentitiesUnsafe()))
+	require.NoError(t, err)
+	entries, err := entity.TlogEntries()
+	require.NoError(t, err)
+
+	provenance := newProvenance(entries, result)
+	logID, err := virtualSigstore.RekorLogID()
+	require.NoError(t, err)
+	assert.Equal(t, logID, provenance.LogID)
+	assert.Equal(t, entries[0].LogIndex(), provenance.LogIndex)
+	assert.True(t, integratedTime.Equal(provenance.IntegratedTime))
+	assert.Equal(t, time.UTC, provenance.IntegratedTime.Location())
+	assert.Len(t, provenance.SignedTimestamps, 1)
+	assert.Equal(t, "https://github.com/tinfoilsh/repo/.github/workflows/release.yml@refs/tags/v1.2.3", provenance.SignerSAN)
+	assert.Equal(t, oidcIssuer, provenance.Issuer)
+}
+
+func TestProvenanceCheckTag(t *testing.T) {
+	provenance := &Provenance{WorkflowRef: "refs/tags/v1.2.3"}
+	assert.NoError(t, provenance.checkTag("v1.2.3"))
+	assert.NoError(t, provenance.checkTag(""))
+	assert.ErrorIs(t, provenance.checkTag("v1.2.4"), ErrRefMismatch)
+	assert.ErrorIs(t, provenance.checkTag("v1.2"), ErrRefMismatch)
+
+	branch := &Provenance{WorkflowRef: "refs/heads/v1.2.3"}
+	assert.ErrorIs(t, branch.checkTag("v1.2.3"), ErrRefMismatch)
+}
@@ -8,7 +8,6 @@ import (
 	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
 	"github.com/sigstore/sigstore-go/pkg/bundle"
 	"github.com/sigstore/sigstore-go/pkg/root"
-	"github.com/sigstore/sigstore-go/pkg/tuf"
 	"github.com/sigstore/sigstore-go/pkg/verify"
 
 	"github.com/tinfoilsh/verifier/attestation"
@@ -20,23 +19,50 @@ const (
 )
 
 type Client struct {
-	trustRoot *root.TrustedRoot
+	trustRoot         root.TrustedMaterial
+	trustRootStatuses []*TrustRootStatus
+	identity          IdentityPolicy
 }
 
+// NewClient creates a client with the trusted root from the default TUF cache, refreshed from the TUF repo when it is older than a day
 func NewClient() (*Client, error) {
-	trustRootJSON, err := FetchTrustRoot()
-	if err != nil {
-		return nil, fmt.Errorf("fetching trust root: %w", err)
+	return NewClientWithOptions(TrustRootOptions{})
+}
+
+// NewClientWithOptions creates a client with the trusted root loaded according to opts
+func NewClientWithOptions(opts TrustRootOptions) (*Client, error) {
+	return NewClientWithTrustRoots(opts)
+}
+
+// NewClientWithTrustRoots creates a client that accepts bundles verified by any of the trusted roots,
+// such as the public good instance together with a private Sigstore instance
+func NewClientWithTrustRoots(opts ...TrustRootOptions) (*Client, error) {
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("no trust roots")
 	}
 
-	trustRoot, err := root.NewTrustedRootFromJSON(trustRootJSON)
-	if err != nil {
-		return nil, fmt.Errorf("parsing trust root: %w", err)
+	var trustRoots root.TrustedMaterialCollection
+	var statuses []*TrustRootStatus
+	for _, o := range opts {
+		trustRootJSON, status, err := LoadTrustRoot(o)
+		if err != nil {
+			return nil, fmt.Errorf("fetching trust root from %s: %w", mirror(o), err)
+		}
+		trustRoot, err := root.NewTrustedRootFromJSON(trustRootJSON)
+		if err != nil {
+			return nil, fmt.Errorf("parsing trust root from %s: %w", mirror(o), err)
+		}
+		trustRoots = append(trustRoots, trustRoot)
+		statuses = append(statuses, status)
 	}
 
-	return &Client{
-		trustRoot: trustRoot,
-	}, nil
+	client := &Client{trustRootStatuses: statuses}
+	if len(trustRoots) == 1 {
+		client.trustRoot = trustRoots[0]
+	} else {
+		client.trustRoot = trustRoots
+	}
+	return client, nil
 }
 
 func NewClientFromJSON(trustRootJSON []byte) (*Client, error) {
@@ -47,29 +73,46 @@ func NewClientFromJSON(trustRootJSON []byte) (*Client, error) {
 	return &Client{trustRoot: trustRoot}, nil
 }
 
-// FetchTrustRoot fetches the trust root from the Sigstore TUF repo
+// FetchTrustRoot fetches the trust root from the Sigstore TUF repo, bypassing the cache
 func FetchTrustRoot() ([]byte, error) {
-	tufOpts := tuf.
-		DefaultOptions().
-		WithDisableLocalCache()
-	//WithFetcher(util.NewFetcher())
-	client, err := tuf.New(tufOpts)
-	if err != nil {
-		return nil, err
+	return fetchTUFTarget(tufOptions(TrustRootOptions{}, ""))
+}
+
+// TrustRootStatus describes where the client's first trusted root was loaded from and how old it is.
+// It is nil for clients created from trusted root JSON.
+func (c *Client) TrustRootStatus() *TrustRootStatus {
+	if len(c.trustRootStatuses) == 0 {
+		return nil
 	}
+	return c.trustRootStatuses[0]
+}
 
-	return client.GetTarget("trusted_root.json")
+// TrustRootStatuses describes each of the client's trusted roots, in the order they were given
+func (c *Client) TrustRootStatuses() []*TrustRootStatus {
+	return c.trustRootStatuses
 }
 
+// WithIdentityPolicy returns a copy of the client that verifies bundles against the given signer identity policy.
+// The trust root is shared with the original client.
+func (c *Client) WithIdentityPolicy(policy IdentityPolicy) *Client {
+	return &Client{trustRoot: c.trustRoot, trustRootStatuses: c.trustRootStatuses, identity: policy}
+}
+
+// VerifyBundle verifies a sigstore bundle for the digest, signed by a GitHub Actions workflow of the repo matching the client's identity policy
 func (c *Client) VerifyBundle(bundleJSON []byte, repo, hexDigest string) (*verify.VerificationResult, error) {
+	result, _, err := c.verifyBundle(bundleJSON, repo, hexDigest, c.identity)
+	return result, err
+}
+
+func (c *Client) verifyBundle(bundleJSON []byte, repo, hexDigest string, identity IdentityPolicy) (*verify.VerificationResult, *Provenance, error) {
 	if c.trustRoot == nil {
-		return nil, fmt.Errorf("trust root is not set")
+		return nil, nil, fmt.Errorf("trust root is not set")
 	}
 
 	var b bundle.Bundle
 	b.Bundle = new(protobundle.Bundle)
 	if err := b.UnmarshalJSON(bundleJSON); err != nil {
-		return nil, fmt.Errorf("parsing bundle: %w", err)
+		return nil, nil, fmt.Errorf("parsing bundle: %w", err)
 	}
 
 	verifier, err := verify.NewSignedEntityVerifier(
@@ -79,23 +122,17 @@ func (c *Client) VerifyBundle(bundleJSON []byte, repo, hexDigest string) (*verif
 		verify.WithObserverTimestamps(1),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("creating signed entity verifier: %w", err)
+		return nil, nil, fmt.Errorf("creating signed entity verifier: %w", err)
 	}
 
-	certID, err := verify.NewShortCertificateIdentity(
-		oidcIssuer,
-		"",
-		"",
-		// TODO: Can we pin this to latest without fetching the latest release?
-		"^https://github.com/"+repo+"/.github/workflows/.*@refs/tags/*",
-	)
+	certID, err := identity.certificateIdentity(repo)
 	if err != nil {
-		return nil, fmt.Errorf("creating certificate identity: %w", err)
+		return nil, nil, fmt.Errorf("creating certificate identity: %w", err)
 	}
 
 	digest, err := hex.DecodeString(hexDigest)
 	if err != nil {
-		return nil, fmt.Errorf("decoding hex digest: %w", err)
+		return nil, nil, fmt.Errorf("decoding hex digest: %w", err)
 	}
 	result, err := verifier.Verify(
 		&b,
@@ -105,10 +142,12 @@ func (c *Client) VerifyBundle(bundleJSON []byte, repo, hexDigest string) (*verif
 		),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("verifying: %w", err)
+		return nil, nil, fmt.Errorf("verifying: %w", err)
 	}
 
-	return result, nil
+	// The verifier has checked the entries, so reading them again cannot fail
+	entries, _ := b.TlogEntries()
+	return result, newProvenance(entries, result), nil
 }
 
 func (c *Client) VerifyAttestation(
@@ -119,7 +158,11 @@ func (c *Client) VerifyAttestation(
 	if err != nil {
 		return nil, fmt.Errorf("verifying bundle: %w", err)
 	}
+	return measurementFromResult(result)
+}
 
+// measurementFromResult returns the code measurement in the predicate of a verified bundle
+func measurementFromResult(result *verify.VerificationResult) (*attestation.Measurement, error) {
 	predicate := result.Statement.Predicate
 	predicateFields := predicate.Fields
 
@@ -173,22 +216,29 @@ func (c *Client) VerifyAttestation(
 
 // FetchHardwareMeasurements fetches the MRTD and RTMR0 from a given hardware repo
 func (c *Client) FetchHardwareMeasurements(repo, digest string) ([]*attestation.HardwareMeasurement, error) {
-	sigstoreBundle, err := github.FetchAttestationBundle(repo, digest)
+	return c.fetchHardwareMeasurements(github.DefaultSource, repo, "", digest)
+}
+
+// fetchHardwareMeasurements fetches the hardware measurements of a digest, built from tag if it is set
+func (c *Client) fetchHardwareMeasurements(src *github.Source, repo, tag, digest string) ([]*attestation.HardwareMeasurement, error) {
+	sigstoreBundles, err := src.FetchAttestationBundles(repo, digest)
 	if err != nil {
 		return nil, err
 	}
 
-	bundle, err := c.VerifyBundle(sigstoreBundle, repo, digest)
+	// The identity policy describes the enclave's release workflow, not the hardware measurement repo's
+	identity := IdentityPolicy{}
+	if src.ServerURL != "" {
+		identity = EnterpriseIdentityPolicy(src.ServerURL)
+	}
+	bundle, _, _, err := c.selectBundle(sigstoreBundles, repo, tag, digest, identity, func(predicateType attestation.PredicateType) bool {
+		return predicateType == attestation.HardwareMeasurementsV1
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	predicate := bundle.Statement.Predicate
-	predicateType := bundle.Statement.PredicateType
-
-	if attestation.PredicateType(predicateType) != attestation.HardwareMeasurementsV1 {
-		return nil, fmt.Errorf("unexpected predicate type: %s", predicateType)
-	}
 
 	var measurements []*attestation.HardwareMeasurement
 	for k, v := range predicate.Fields {
@@ -233,13 +283,7 @@ func VerifyAttestation(
 	return client.VerifyAttestation(bundleJSON, repo, hexDigest)
 }
 
-// LatestHardwareMeasurements fetches the latest hardware measurements from GitHub+Sigstore
+// LatestHardwareMeasurements fetches the measurements of the latest release of DefaultHardwareRepo
 func (c *Client) LatestHardwareMeasurements() ([]*attestation.HardwareMeasurement, error) {
-	const repo = "tinfoilsh/hardware-measurements"
-	digest, err := github.FetchLatestDigest(repo)
-	if err != nil {
-		return nil, err
-	}
-
-	return c.FetchHardwareMeasurements(repo, digest)
+	return HardwareRepo{Repo: DefaultHardwareRepo}.HardwareMeasurements(c)
 }
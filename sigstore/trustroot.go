@@ -0,0 +1,283 @@
+package sigstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+
+	"github.com/tinfoilsh/verifier/util"
+)
+
+const (
+	// DefaultTrustRootCacheValidity is how long a cached trusted root is used before the TUF repo is checked for updates
+	DefaultTrustRootCacheValidity = 24 * time.Hour
+
+	trustRootTarget = "trusted_root.json"
+)
+
+// TrustRootSource is where a trusted root was loaded from
+type TrustRootSource string
+
+const (
+	// TrustRootFromCache is a trusted root from the local TUF cache, used without contacting the TUF repo
+	TrustRootFromCache TrustRootSource = "cache"
+	// TrustRootFromNetwork is a trusted root freshly updated from the TUF repo
+	TrustRootFromNetwork TrustRootSource = "network"
+	// TrustRootEmbedded is the trusted root compiled into the binary
+	TrustRootEmbedded TrustRootSource = "embedded"
+)
+
+// TrustRootStatus describes the trusted root a client verifies bundles with
+type TrustRootStatus struct {
+	Source TrustRootSource `json:"source"`
+	// UpdatedAt is when the root was last updated from the TUF repo. An embedded root does not record when it was
+	// fetched, so the start of validity of its newest key is reported instead and Age is an upper bound.
+	UpdatedAt time.Time `json:"updated_at"`
+	// Expires is when the TUF metadata vouching for the root expires. It is zero for an embedded root,
+	// which is not covered by TUF metadata.
+	Expires time.Time `json:"expires,omitempty"`
+	// Err is why a preferred source could not be used
+	Err error `json:"-"`
+}
+
+// Age returns how long ago the trusted root was updated, or zero if s is nil
+func (s *TrustRootStatus) Age() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Since(s.UpdatedAt)
+}
+
+// Warning describes why the trusted root in use may be outdated, or returns an empty string if it is current.
+// A nil status, as reported before any root was loaded, has no warning.
+func (s *TrustRootStatus) Warning() string {
+	if s == nil {
+		return ""
+	}
+	var msg string
+	switch {
+	case s.Source == TrustRootEmbedded:
+		msg = fmt.Sprintf("using embedded Sigstore trusted root, up to %d days old", int(s.Age().Hours()/24))
+	case s.Source == TrustRootFromCache && s.Err != nil:
+		msg = fmt.Sprintf("using cached Sigstore trusted root from %s, valid until %s",
+			s.UpdatedAt.Format(time.DateOnly), s.Expires.Format(time.DateOnly))
+	default:
+		return ""
+	}
+	if s.Err != nil {
+		msg += fmt.Sprintf(": %v", s.Err)
+	}
+	return msg
+}
+
+// TrustRootOptions configures where a trusted root is loaded from.
+// The zero value loads the root of the Sigstore public good instance.
+type TrustRootOptions struct {
+	// Mirror is the base URL of the TUF repo serving trusted_root.json. Empty uses the public good instance.
+	Mirror string
+	// Root is the initial root.json of the TUF repo, required with a custom Mirror
+	Root []byte
+	// Transport fetches the TUF metadata and targets; nil uses http.DefaultTransport
+	Transport http.RoundTripper
+	// CacheDir is the directory TUF metadata and targets are cached in.
+	// Empty uses DefaultTrustRootCacheDir; if that is unavailable, nothing is cached.
+	CacheDir string
+	// CacheValidity is how long a cached root is used before the TUF repo is checked for updates.
+	// Zero uses DefaultTrustRootCacheValidity.
+	CacheValidity time.Duration
+	// Embedded is the trusted root JSON used when neither the cache nor the TUF repo is available.
+	// It must belong to the same Sigstore instance as the TUF repo.
+	Embedded []byte
+}
+
+// DefaultTrustRootCacheDir returns the per-user cache directory for Sigstore TUF metadata
+func DefaultTrustRootCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "tinfoil", "sigstore"), nil
+}
+
+// LoadTrustRoot returns the Sigstore trusted root JSON, trying in order a cached root still within its
+// cache validity, the TUF repo, any cached root whose TUF metadata has not expired, and the embedded root
+func LoadTrustRoot(opts TrustRootOptions) ([]byte, *TrustRootStatus, error) {
+	if opts.Mirror != "" && opts.Mirror != tuf.DefaultMirror && len(opts.Root) == 0 {
+		return nil, nil, fmt.Errorf("TUF mirror %s requires its initial root.json", opts.Mirror)
+	}
+
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		cacheDir, _ = DefaultTrustRootCacheDir()
+	}
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0700); err != nil {
+			cacheDir = ""
+		}
+	}
+	validity := opts.CacheValidity
+	if validity == 0 {
+		validity = DefaultTrustRootCacheValidity
+	}
+
+	var errs []error
+	if cacheDir != "" {
+		if updatedAt := cacheUpdatedAt(opts, cacheDir); !updatedAt.IsZero() && time.Since(updatedAt) < validity {
+			trustRootJSON, status, err := fetchCachedTrustRoot(opts, cacheDir)
+			if err == nil {
+				return trustRootJSON, status, nil
+			}
+			errs = append(errs, fmt.Errorf("cache: %w", err))
+		}
+	}
+
+	trustRootJSON, err := fetchTUFTarget(tufOptions(opts, cacheDir))
+	if err == nil {
+		status := &TrustRootStatus{Source: TrustRootFromNetwork, UpdatedAt: time.Now()}
+		if cacheDir != "" {
+			status.Expires = cacheExpires(opts, cacheDir)
+		}
+		return trustRootJSON, status, nil
+	}
+	errs = append(errs, fmt.Errorf("network: %w", err))
+
+	if cacheDir != "" {
+		// Offline: a cached root past its cache validity is still trusted until its TUF metadata expires
+		trustRootJSON, status, err := fetchCachedTrustRoot(opts, cacheDir)
+		if err == nil {
+			status.Err = errors.Join(errs...)
+			return trustRootJSON, status, nil
+		}
+	}
+
+	if len(opts.Embedded) == 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return opts.Embedded, &TrustRootStatus{
+		Source:    TrustRootEmbedded,
+		UpdatedAt: embeddedUpdatedAt(opts.Embedded),
+		Err:       errors.Join(errs...),
+	}, nil
+}
+
+// tufOptions returns the TUF client options for the TUF repo, caching in cacheDir if set
+func tufOptions(opts TrustRootOptions, cacheDir string) *tuf.Options {
+	tufOpts := tuf.DefaultOptions().
+		WithRepositoryBaseURL(mirror(opts)).
+		WithFetcher(util.NewFetcherWithTransport(opts.Transport))
+	if len(opts.Root) > 0 {
+		tufOpts = tufOpts.WithRoot(opts.Root)
+	}
+	if cacheDir == "" {
+		return tufOpts.WithDisableLocalCache()
+	}
+	return tufOpts.WithCachePath(cacheDir)
+}
+
+func mirror(opts TrustRootOptions) string {
+	if opts.Mirror == "" {
+		return tuf.DefaultMirror
+	}
+	return opts.Mirror
+}
+
+// fetchCachedTrustRoot reads the trusted root from the TUF cache without contacting the TUF repo
+func fetchCachedTrustRoot(opts TrustRootOptions, cacheDir string) ([]byte, *TrustRootStatus, error) {
+	updatedAt := cacheUpdatedAt(opts, cacheDir)
+	trustRootJSON, err := fetchTUFTarget(tufOptions(opts, cacheDir).WithForceCache())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	status := &TrustRootStatus{Source: TrustRootFromCache, UpdatedAt: updatedAt, Expires: cacheExpires(opts, cacheDir)}
+	// The TUF client refreshes from the network if the cached metadata cannot be loaded
+	if refreshedAt := cacheUpdatedAt(opts, cacheDir); refreshedAt.After(updatedAt) {
+		status.Source = TrustRootFromNetwork
+		status.UpdatedAt = refreshedAt
+	}
+	return trustRootJSON, status, nil
+}
+
+func fetchTUFTarget(opts *tuf.Options) ([]byte, error) {
+	client, err := tuf.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetTarget(trustRootTarget)
+}
+
+// cacheUpdatedAt returns when the TUF cache was last refreshed, or zero if it never was
+func cacheUpdatedAt(opts TrustRootOptions, cacheDir string) time.Time {
+	config, err := tuf.LoadConfig(filepath.Join(cacheDir, tuf.URLToPath(mirror(opts))+".json"))
+	if err != nil {
+		return time.Time{}
+	}
+	return config.LastTimestamp
+}
+
+// cacheExpires returns the earliest expiry of the cached top-level TUF metadata
+func cacheExpires(opts TrustRootOptions, cacheDir string) time.Time {
+	var expires time.Time
+	for _, role := range []string{"root", "timestamp", "snapshot", "targets"} {
+		data, err := os.ReadFile(filepath.Join(cacheDir, tuf.URLToPath(mirror(opts)), role+".json"))
+		if err != nil {
+			continue
+		}
+		var metadata struct {
+			Signed struct {
+				Expires time.Time `json:"expires"`
+			} `json:"signed"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			continue
+		}
+		if expires.IsZero() || metadata.Signed.Expires.Before(expires) {
+			expires = metadata.Signed.Expires
+		}
+	}
+	return expires
+}
+
+// embeddedUpdatedAt returns the start of validity of the newest key in a trusted root.
+// The root cannot have been fetched before then.
+func embeddedUpdatedAt(trustRootJSON []byte) time.Time {
+	type validFor struct {
+		ValidFor struct {
+			Start time.Time `json:"start"`
+		} `json:"validFor"`
+	}
+	type keyed struct {
+		PublicKey validFor `json:"publicKey"`
+	}
+	var trustRoot struct {
+		Tlogs                  []keyed    `json:"tlogs"`
+		Ctlogs                 []keyed    `json:"ctlogs"`
+		CertificateAuthorities []validFor `json:"certificateAuthorities"`
+		TimestampAuthorities   []validFor `json:"timestampAuthorities"`
+	}
+	if err := json.Unmarshal(trustRootJSON, &trustRoot); err != nil {
+		return time.Time{}
+	}
+
+	var starts []time.Time
+	for _, log := range append(trustRoot.Tlogs, trustRoot.Ctlogs...) {
+		starts = append(starts, log.PublicKey.ValidFor.Start)
+	}
+	for _, authority := range append(trustRoot.CertificateAuthorities, trustRoot.TimestampAuthorities...) {
+		starts = append(starts, authority.ValidFor.Start)
+	}
+
+	var newest time.Time
+	for _, start := range starts {
+		if start.After(newest) {
+			newest = start
+		}
+	}
+	return newest
+}
@@ -0,0 +1,243 @@
+package sigstore
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+func TestLoadTrustRootCache(t *testing.T) {
+	server, rootJSON := newTestTUFRepo(t, testTrustRoot(t))
+	opts := TrustRootOptions{Mirror: server.URL, Root: rootJSON, CacheDir: t.TempDir()}
+
+	trustRootJSON, status, err := LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, TrustRootFromNetwork, status.Source)
+	assert.True(t, status.Expires.After(time.Now()))
+
+	cached, status, err := LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, TrustRootFromCache, status.Source)
+	assert.Equal(t, trustRootJSON, cached)
+	assert.Empty(t, status.Warning())
+}
+
+func TestCacheMetadata(t *testing.T) {
+	cacheDir := t.TempDir()
+	assert.True(t, cacheUpdatedAt(TrustRootOptions{}, cacheDir).IsZero())
+	assert.True(t, cacheExpires(TrustRootOptions{}, cacheDir).IsZero())
+
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	config := &tuf.Config{LastTimestamp: updatedAt}
+	require.NoError(t, config.Persist(filepath.Join(cacheDir, tuf.URLToPath(tuf.DefaultMirror)+".json")))
+	assert.True(t, updatedAt.Equal(cacheUpdatedAt(TrustRootOptions{}, cacheDir)))
+
+	metadataDir := filepath.Join(cacheDir, tuf.URLToPath(tuf.DefaultMirror))
+	require.NoError(t, os.MkdirAll(metadataDir, 0700))
+	for role, expires := range map[string]string{
+		"root":      "2027-01-01T00:00:00Z",
+		"timestamp": "2026-01-09T00:00:00Z",
+		"snapshot":  "2026-01-16T00:00:00Z",
+		"targets":   "2026-06-01T00:00:00Z",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(metadataDir, role+".json"), []byte(`{"signed":{"expires":"`+expires+`"}}`), 0600))
+	}
+	assert.True(t, time.Date(2026, 1, 9, 0, 0, 0, 0, time.UTC).Equal(cacheExpires(TrustRootOptions{}, cacheDir)))
+}
+
+func TestEmbeddedUpdatedAt(t *testing.T) {
+	trustRootJSON := []byte(`{
+		"tlogs": [{"publicKey": {"validFor": {"start": "2021-01-12T11:53:27Z"}}}],
+		"ctlogs": [{"publicKey": {"validFor": {"start": "2022-10-20T00:00:00Z"}}}],
+		"certificateAuthorities": [{"validFor": {"start": "2022-04-13T20:06:15Z"}}],
+		"timestampAuthorities": [{"validFor": {"start": "2025-07-04T00:00:00Z"}}]
+	}`)
+	assert.True(t, time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC).Equal(embeddedUpdatedAt(trustRootJSON)))
+	assert.True(t, embeddedUpdatedAt([]byte("not json")).IsZero())
+}
+
+func TestTrustRootStatusWarning(t *testing.T) {
+	network := &TrustRootStatus{Source: TrustRootFromNetwork, UpdatedAt: time.Now()}
+	assert.Empty(t, network.Warning())
+
+	cached := &TrustRootStatus{Source: TrustRootFromCache, UpdatedAt: time.Now().Add(-time.Hour)}
+	assert.Empty(t, cached.Warning())
+	cached.Err = errors.New("network: unreachable")
+	assert.Contains(t, cached.Warning(), "network: unreachable")
+
+	embedded := &TrustRootStatus{Source: TrustRootEmbedded, UpdatedAt: time.Now().Add(-100 * 24 * time.Hour)}
+	assert.Contains(t, embedded.Warning(), "100 days")
+
+	var unloaded *TrustRootStatus
+	assert.Empty(t, unloaded.Warning())
+	assert.Zero(t, unloaded.Age())
+}
+
+// newTestTUFRepo serves a single-key TUF repo with target as trusted_root.json and returns its initial root.json
+func newTestTUFRepo(t *testing.T, target []byte) (*httptest.Server, []byte) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := metadata.KeyFromPublicKey(private.Public())
+	require.NoError(t, err)
+	signer, err := signature.LoadSigner(private, crypto.Hash(0))
+	require.NoError(t, err)
+
+	expires := time.Now().Add(24 * time.Hour)
+	rootMeta := metadata.Root(expires)
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		require.NoError(t, rootMeta.Signed.AddKey(key, role))
+	}
+	targets := metadata.Targets(expires)
+	targetFile, err := metadata.TargetFile().FromBytes(trustRootTarget, target, "sha256")
+	require.NoError(t, err)
+	targets.Signed.Targets[trustRootTarget] = targetFile
+	snapshot := metadata.Snapshot(expires)
+	timestamp := metadata.Timestamp(expires)
+
+	_, err = rootMeta.Sign(signer)
+	require.NoError(t, err)
+	_, err = targets.Sign(signer)
+	require.NoError(t, err)
+	_, err = snapshot.Sign(signer)
+	require.NoError(t, err)
+	_, err = timestamp.Sign(signer)
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"/targets/" + hex.EncodeToString(targetFile.Hashes["sha256"]) + "." + trustRootTarget: target,
+	}
+	for name, meta := range map[string]interface{ ToBytes(bool) ([]byte, error) }{
+		"/1.root.json":     rootMeta,
+		"/1.targets.json":  targets,
+		"/1.snapshot.json": snapshot,
+		"/timestamp.json":  timestamp,
+	} {
+		data, err := meta.ToBytes(false)
+		require.NoError(t, err)
+		files[name] = data
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, files["/1.root.json"]
+}
+
+// countingTransport counts the requests made through it
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func testTrustRoot(t *testing.T) []byte {
+	trustRootJSON, err := os.ReadFile("../client/trusted_root.json")
+	require.NoError(t, err)
+	return trustRootJSON
+}
+
+func TestLoadTrustRootMirror(t *testing.T) {
+	trustRootJSON := testTrustRoot(t)
+	server, rootJSON := newTestTUFRepo(t, trustRootJSON)
+	transport := &countingTransport{}
+	opts := TrustRootOptions{
+		Mirror:    server.URL,
+		Root:      rootJSON,
+		Transport: transport,
+		CacheDir:  t.TempDir(),
+	}
+
+	loaded, status, err := LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, trustRootJSON, loaded)
+	assert.Equal(t, TrustRootFromNetwork, status.Source)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), status.Expires, time.Minute)
+	requests := transport.requests.Load()
+	assert.Positive(t, requests)
+
+	loaded, status, err = LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, trustRootJSON, loaded)
+	assert.Equal(t, TrustRootFromCache, status.Source)
+	assert.Equal(t, requests, transport.requests.Load())
+
+	// Past its cache validity, the cached root is still used while the mirror is unreachable
+	server.Close()
+	opts.CacheValidity = time.Nanosecond
+	loaded, status, err = LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, trustRootJSON, loaded)
+	assert.Equal(t, TrustRootFromCache, status.Source)
+	assert.Error(t, status.Err)
+	assert.NotEmpty(t, status.Warning())
+}
+
+func TestLoadTrustRootEmbeddedFallback(t *testing.T) {
+	trustRootJSON := testTrustRoot(t)
+	server, rootJSON := newTestTUFRepo(t, trustRootJSON)
+	server.Close()
+
+	opts := TrustRootOptions{Mirror: server.URL, Root: rootJSON, CacheDir: t.TempDir()}
+	_, _, err := LoadTrustRoot(opts)
+	assert.Error(t, err)
+
+	opts.Embedded = trustRootJSON
+	loaded, status, err := LoadTrustRoot(opts)
+	require.NoError(t, err)
+	assert.Equal(t, trustRootJSON, loaded)
+	assert.Equal(t, TrustRootEmbedded, status.Source)
+	assert.Error(t, status.Err)
+	assert.True(t, status.Expires.IsZero())
+	assert.NotEmpty(t, status.Warning())
+}
+
+func TestLoadTrustRootMirrorRequiresRoot(t *testing.T) {
+	_, _, err := LoadTrustRoot(TrustRootOptions{Mirror: "https://tuf.example.com", CacheDir: t.TempDir()})
+	assert.ErrorContains(t, err, "initial root.json")
+}
+
+func TestNewClientWithTrustRoots(t *testing.T) {
+	trustRootJSON := testTrustRoot(t)
+	public, publicRoot := newTestTUFRepo(t, trustRootJSON)
+	private, privateRoot := newTestTUFRepo(t, trustRootJSON)
+	cacheDir := t.TempDir()
+
+	client, err := NewClientWithTrustRoots(
+		TrustRootOptions{Mirror: public.URL, Root: publicRoot, CacheDir: cacheDir},
+		TrustRootOptions{Mirror: private.URL, Root: privateRoot, CacheDir: cacheDir},
+	)
+	require.NoError(t, err)
+	require.Len(t, client.TrustRootStatuses(), 2)
+	assert.Equal(t, client.TrustRootStatuses()[0], client.TrustRootStatus())
+	assert.IsType(t, root.TrustedMaterialCollection{}, client.trustRoot)
+
+	_, err = NewClientWithTrustRoots()
+	assert.Error(t, err)
+}
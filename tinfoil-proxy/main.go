@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tinfoilsh/verifier/client"
+	"github.com/tinfoilsh/verifier/config"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+var (
+	listenAddr   = flag.String("listen", "127.0.0.1:8080", "local address to listen on")
+	enclave      = flag.String("enclave", "inference.tinfoil.sh", "enclave host")
+	repo         = flag.String("repo", "tinfoilsh/confidential-model-router", "source repo of the enclave")
+	interval     = flag.Duration("interval", time.Hour, "re-verification interval")
+	statusPath   = flag.String("status-path", "/.tinfoil/status", "path of the local status endpoint")
+	releaseTag   = flag.String("tag", "", "verify against this release tag instead of the latest release")
+	digest       = flag.String("digest", "", "verify against this release digest instead of the latest release")
+	allowed      = flag.String("allowed", "", "accept any release whose tag satisfies this semver constraint")
+	lastReleases = flag.Int("last", 0, "accept any of the last N releases")
+	maxAge       = flag.Duration("max-release-age", 0, "reject releases attested longer ago than this")
+	ehbp         = flag.Bool("ehbp", false, "encrypt bodies to the enclave's HPKE key instead of pinning TLS")
+	tufCache     = flag.String("tuf-cache", "", "Sigstore TUF cache directory (default: user cache directory)")
+	signatures   = flag.Bool("signatures", false, "verify the enclave's response signatures instead of pinning TLS")
+
+	workflow   = flag.String("workflow", "", "require the release to be signed by this workflow, e.g. .github/workflows/release.yml")
+	runner     = flag.String("runner", "", "require the signing workflow to run on this runner environment, github-hosted or self-hosted")
+	commit     = flag.String("commit", "", "require the signing workflow to run on this commit SHA")
+	ownerID    = flag.String("owner-id", "", "require the repo to be owned by this numeric GitHub ID")
+	refPattern []string
+)
+
+func init() {
+	flag.Func("ref", "require the signing workflow's git ref to match this regular expression (repeatable)", func(pattern string) error {
+		refPattern = append(refPattern, pattern)
+		return nil
+	})
+}
+
+func main() {
+	flag.Parse()
+	if *interval <= 0 {
+		log.Fatalf("Invalid re-verification interval %v: must be positive", *interval)
+	}
+
+	var opts []client.Option
+	if *releaseTag != "" {
+		opts = append(opts, client.WithReleaseTag(*releaseTag))
+	}
+	if *digest != "" {
+		opts = append(opts, client.WithDigest(*digest))
+	}
+	if *allowed != "" {
+		allowedReleases, err := config.New(*allowed)
+		if err != nil {
+			log.Fatalf("Invalid release constraint: %v", err)
+		}
+		opts = append(opts, client.WithAllowedReleases(allowedReleases))
+	}
+	if *lastReleases > 0 {
+		opts = append(opts, client.WithLastReleases(*lastReleases))
+	}
+	if *maxAge > 0 {
+		opts = append(opts, client.WithMaxReleaseAge(*maxAge))
+	}
+	if *ehbp {
+		opts = append(opts, client.WithEHBP())
+	}
+	if *tufCache != "" {
+		opts = append(opts, client.WithTrustRootCacheDir(*tufCache))
+	}
+	if *signatures {
+		opts = append(opts, client.WithResponseSignatures())
+	}
+	if *workflow != "" || len(refPattern) > 0 || *runner != "" || *commit != "" || *ownerID != "" {
+		opts = append(opts, client.WithIdentityPolicy(sigstore.IdentityPolicy{
+			Workflow:                *workflow,
+			RefPatterns:             refPattern,
+			RunnerEnvironment:       *runner,
+			SourceRepositoryDigest:  *commit,
+			SourceRepositoryOwnerID: *ownerID,
+		}))
+	}
+
+	p := newProxy(client.NewSecureClient(*enclave, *repo, opts...), *statusPath)
+	p.verify()
+	go func() {
+		for range time.Tick(*interval) {
+			p.verify()
+		}
+	}()
+
+	log.Printf("Forwarding http://%s to %s, status at %s", *listenAddr, *enclave, *statusPath)
+	log.Fatal(http.ListenAndServe(*listenAddr, p))
+}
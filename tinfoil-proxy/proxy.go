@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/tinfoilsh/verifier/client"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+// enclaveClient is the part of client.SecureClient the proxy uses
+type enclaveClient interface {
+	Enclave() string
+	Repo() string
+	Verify() (*client.GroundTruth, error)
+	GroundTruth() *client.GroundTruth
+	TrustRootStatuses() []*sigstore.TrustRootStatus
+	HTTPClient() (*http.Client, error)
+}
+
+// proxy forwards requests to the enclave only while its last verification succeeded
+type proxy struct {
+	client     enclaveClient
+	statusPath string
+
+	mu         sync.RWMutex
+	verified   bool
+	verifyErr  error
+	verifiedAt time.Time
+}
+
+// newProxy returns a proxy to the client's enclave serving its status at statusPath. It refuses requests until verify succeeds.
+func newProxy(c enclaveClient, statusPath string) *proxy {
+	return &proxy{client: c, statusPath: statusPath}
+}
+
+type status struct {
+	Enclave     string                      `json:"enclave"`
+	Repo        string                      `json:"repo"`
+	Verified    bool                        `json:"verified"`
+	Error       string                      `json:"error,omitempty"`
+	VerifiedAt  *time.Time                  `json:"verified_at,omitempty"`
+	GroundTruth *client.GroundTruth         `json:"ground_truth,omitempty"`
+	TrustRoots  []*sigstore.TrustRootStatus `json:"trust_roots,omitempty"`
+}
+
+func (p *proxy) verify() {
+	groundTruth, err := p.client.Verify()
+	for _, trustRoot := range p.client.TrustRootStatuses() {
+		if warning := trustRoot.Warning(); warning != "" {
+			log.Printf("Warning: %s", warning)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.verified = err == nil
+	p.verifyErr = err
+	if err != nil {
+		log.Printf("Verification of %s failed, refusing to forward: %v", p.client.Enclave(), err)
+		return
+	}
+	p.verifiedAt = time.Now()
+	log.Printf("Verified %s (digest %s)", groundTruth.EnclaveHost, groundTruth.Digest)
+}
+
+func (p *proxy) status() status {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	s := status{
+		Enclave:    p.client.Enclave(),
+		Repo:       p.client.Repo(),
+		Verified:   p.verified,
+		TrustRoots: p.client.TrustRootStatuses(),
+	}
+	if p.verifyErr != nil {
+		s.Error = p.verifyErr.Error()
+	}
+	if p.verified {
+		verifiedAt := p.verifiedAt
+		s.VerifiedAt = &verifiedAt
+		s.GroundTruth = p.client.GroundTruth()
+	}
+	return s
+}
+
+// RoundTrip sends the request over the attested transport of the current ground truth
+func (p *proxy) RoundTrip(r *http.Request) (*http.Response, error) {
+	httpClient, err := p.client.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return httpClient.Transport.RoundTrip(r)
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == p.statusPath {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.status())
+		return
+	}
+
+	if s := p.status(); !s.Verified {
+		http.Error(w, "enclave not verified: "+s.Error, http.StatusServiceUnavailable)
+		return
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = "https"
+			r.Out.URL.Host = p.client.Enclave()
+			r.Out.Host = p.client.Enclave()
+		},
+		Transport: p,
+		// Flush immediately so streamed responses reach the client as they arrive
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Forwarding %s %s failed: %v", r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	reverseProxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tinfoilsh/verifier/client"
+	"github.com/tinfoilsh/verifier/sigstore"
+)
+
+// fakeClient stands in for a SecureClient whose verification result is set by the test
+type fakeClient struct {
+	enclave    string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	groundTruth *client.GroundTruth
+	err         error
+	trustRoots  []*sigstore.TrustRootStatus
+}
+
+func (f *fakeClient) Enclave() string { return f.enclave }
+func (f *fakeClient) Repo() string    { return "org/repo" }
+
+func (f *fakeClient) Verify() (*client.GroundTruth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.groundTruth, nil
+}
+
+func (f *fakeClient) GroundTruth() *client.GroundTruth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.groundTruth
+}
+
+func (f *fakeClient) TrustRootStatuses() []*sigstore.TrustRootStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.trustRoots
+}
+
+func (f *fakeClient) HTTPClient() (*http.Client, error) { return f.httpClient, nil }
+
+func (f *fakeClient) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// newTestProxy serves a proxy to a stand-in enclave echoing the request path
+func newTestProxy(t *testing.T) (*proxy, *fakeClient, *httptest.Server) {
+	enclave := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "enclave "+r.URL.Path)
+	}))
+	t.Cleanup(enclave.Close)
+
+	fake := &fakeClient{
+		enclave:     enclave.Listener.Addr().String(),
+		httpClient:  enclave.Client(),
+		groundTruth: &client.GroundTruth{EnclaveHost: enclave.Listener.Addr().String(), Digest: "abcdef"},
+	}
+	p := newProxy(fake, "/.tinfoil/status")
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+	return p, fake, server
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestProxyRefusesBeforeVerification(t *testing.T) {
+	_, _, server := newTestProxy(t)
+
+	code, body := get(t, server.URL+"/v1/models")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "enclave not verified")
+}
+
+func TestProxyForwardsAfterVerification(t *testing.T) {
+	p, _, server := newTestProxy(t)
+	p.verify()
+
+	code, body := get(t, server.URL+"/v1/models")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "enclave /v1/models", body)
+}
+
+func TestProxyRefusesAfterFailedReverification(t *testing.T) {
+	p, fake, server := newTestProxy(t)
+	p.verify()
+	fake.setErr(errors.New("measurement mismatch"))
+	p.verify()
+
+	code, body := get(t, server.URL+"/v1/models")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "measurement mismatch")
+}
+
+func TestProxyStatus(t *testing.T) {
+	p, fake, server := newTestProxy(t)
+
+	decode := func() status {
+		code, body := get(t, server.URL+"/.tinfoil/status")
+		require.Equal(t, http.StatusOK, code)
+		var s status
+		require.NoError(t, json.Unmarshal([]byte(body), &s))
+		return s
+	}
+
+	s := decode()
+	assert.Equal(t, fake.enclave, s.Enclave)
+	assert.Equal(t, "org/repo", s.Repo)
+	assert.False(t, s.Verified)
+	assert.Nil(t, s.GroundTruth)
+	assert.Empty(t, s.TrustRoots)
+
+	fake.mu.Lock()
+	fake.trustRoots = []*sigstore.TrustRootStatus{
+		{Source: sigstore.TrustRootFromNetwork},
+		{Source: sigstore.TrustRootEmbedded},
+	}
+	fake.mu.Unlock()
+	p.verify()
+	s = decode()
+	assert.True(t, s.Verified)
+	assert.Empty(t, s.Error)
+	assert.NotNil(t, s.VerifiedAt)
+	require.NotNil(t, s.GroundTruth)
+	assert.Equal(t, "abcdef", s.GroundTruth.Digest)
+	require.Len(t, s.TrustRoots, 2)
+	assert.Equal(t, sigstore.TrustRootFromNetwork, s.TrustRoots[0].Source)
+	assert.Equal(t, sigstore.TrustRootEmbedded, s.TrustRoots[1].Source)
+
+	fake.setErr(errors.New("measurement mismatch"))
+	p.verify()
+	s = decode()
+	assert.False(t, s.Verified)
+	assert.Equal(t, "measurement mismatch", s.Error)
+	assert.Nil(t, s.VerifiedAt)
+}
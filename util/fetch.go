@@ -1,18 +1,40 @@
 package util
 
 import (
+	"fmt"
+	"io"
+	"net/http"
 	"time"
 
+	"github.com/theupdateframework/go-tuf/v2/metadata"
 	"github.com/theupdateframework/go-tuf/v2/metadata/fetcher"
 )
 
-type Fetcher struct{}
+// Fetcher downloads TUF metadata and targets over HTTP
+type Fetcher struct {
+	// Transport makes the requests; nil uses http.DefaultTransport
+	Transport http.RoundTripper
+}
 
-func (*Fetcher) DownloadFile(urlPath string, maxLength int64, timeout time.Duration) ([]byte, error) {
-	body, _, err := Get(urlPath)
+func (f *Fetcher) DownloadFile(urlPath string, maxLength int64, timeout time.Duration) ([]byte, error) {
+	client := &http.Client{Transport: f.Transport, Timeout: timeout}
+	resp, err := client.Get(urlPath)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	// The updater relies on the status code to detect the end of root rotation
+	if resp.StatusCode != http.StatusOK {
+		return nil, &metadata.ErrDownloadHTTP{StatusCode: resp.StatusCode, URL: urlPath}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLength+1))
+	if err != nil {
+		return nil, &metadata.ErrDownload{Msg: fmt.Sprintf("failed to read %s: %v", urlPath, err)}
+	}
+	if int64(len(body)) > maxLength {
+		return nil, &metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("%s is larger than %d bytes", urlPath, maxLength)}
+	}
 	return body, nil
 }
 
@@ -23,3 +45,8 @@ var (
 func NewFetcher() *Fetcher {
 	return &Fetcher{}
 }
+
+// NewFetcherWithTransport returns a fetcher that makes its requests with transport
+func NewFetcherWithTransport(transport http.RoundTripper) *Fetcher {
+	return &Fetcher{Transport: transport}
+}
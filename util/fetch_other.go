@@ -9,6 +9,25 @@ import (
 	"net/http"
 )
 
+// Fetch makes a GET request with the given headers and returns the response status, headers and body whatever the status
+func Fetch(url string, header http.Header) (int, http.Header, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
 func Get(url string) ([]byte, map[string][]string, error) {
 	resp, err := http.Get(url)
 	if err != nil {
@@ -5,6 +5,8 @@ package util
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"syscall/js"
 )
 
@@ -56,6 +58,40 @@ func Get(url string) ([]byte, map[string][]string, error) {
 	return data, headers, nil
 }
 
+// Fetch makes a GET request with the given headers using the JavaScript fetch API and returns the response status,
+// headers and body whatever the status
+func Fetch(url string, header http.Header) (int, http.Header, []byte, error) {
+	headers := js.Global().Get("Object").New()
+	for key, values := range header {
+		headers.Set(key, strings.Join(values, ", "))
+	}
+	options := js.Global().Get("Object").New()
+	options.Set("headers", headers)
+
+	result, err := awaitPromise(js.Global().Call("fetch", url, options))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("fetch failed: %v", err)
+	}
+
+	arrayBufferResult, err := awaitPromise(result.Call("arrayBuffer"))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to get array buffer: %v", err)
+	}
+	uint8Array := js.Global().Get("Uint8Array").New(arrayBufferResult)
+	data := make([]byte, uint8Array.Get("length").Int())
+	js.CopyBytesToGo(data, uint8Array)
+
+	respHeader := http.Header{}
+	callback := js.FuncOf(func(this js.Value, args []js.Value) any {
+		respHeader.Add(args[1].String(), args[0].String())
+		return nil
+	})
+	defer callback.Release()
+	result.Get("headers").Call("forEach", callback)
+
+	return result.Get("status").Int(), respHeader, data, nil
+}
+
 // awaitPromise waits for a JavaScript Promise to resolve and returns the result
 func awaitPromise(promise js.Value) (js.Value, error) {
 	resultChan := make(chan js.Value, 1)
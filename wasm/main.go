@@ -13,6 +13,7 @@ import (
 
 	"github.com/tinfoilsh/verifier/attestation"
 	"github.com/tinfoilsh/verifier/client"
+	"github.com/tinfoilsh/verifier/github"
 	"github.com/tinfoilsh/verifier/sigstore"
 	"github.com/tinfoilsh/verifier/util"
 )
@@ -35,36 +36,27 @@ func verifyCode() js.Func {
 				repo := args[0].String()
 				digest := args[1].String()
 
-				bundleURL := "https://gh-attestation-proxy.tinfoil.sh/repos/" + repo + "/attestations/sha256:" + digest
-				log.Printf("Fetching bundle from %s...", bundleURL)
-				bundle, _, err := util.Get(bundleURL)
+				log.Printf("Fetching attestation bundles for %s@%s...", repo, digest)
+				bundles, err := github.FetchAttestationBundles(repo, digest)
 				if err != nil {
 					reject.Invoke(err.Error())
 					return
 				}
 
-				var attestationsData struct {
-					Attestations []struct {
-						Bundle json.RawMessage `json:"bundle"`
-					} `json:"attestations"`
-				}
-				if err := json.Unmarshal(bundle, &attestationsData); err != nil {
-					reject.Invoke(err.Error())
-					return
-				}
-
-				bundleJSON, err := attestationsData.Attestations[0].Bundle.MarshalJSON()
+				sigstoreClient, err := sigstore.NewClientFromJSON(trustedRootJSON)
 				if err != nil {
 					reject.Invoke(err.Error())
 					return
 				}
-
-				measurement, err := sigstore.VerifyAttestation(trustedRootJSON, bundleJSON, repo, digest)
+				verified, skipped, err := sigstoreClient.VerifyAttestations(bundles, repo, digest)
+				for _, s := range skipped {
+					log.Printf("Skipped %s", s)
+				}
 				if err != nil {
 					reject.Invoke(err.Error())
 					return
 				}
-				measurementJSON, err := json.Marshal(measurement)
+				measurementJSON, err := json.Marshal(verified.Measurement)
 				if err != nil {
 					reject.Invoke(err.Error())
 					return